@@ -0,0 +1,121 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// Decode parses a LoaderConfiguration from YAML or JSON. Unlike
+// yaml.Unmarshal, it fails on fields that do not exist, like a misspelled
+// mountPath, with their path.
+func Decode(data []byte) (*LoaderConfiguration, error) {
+	data, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if path := unknownField(reflect.TypeOf(LoaderConfiguration{}), raw, ""); path != "" {
+		return nil, fmt.Errorf("unknown field %s", path)
+	}
+	cfg := &LoaderConfiguration{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// unknownField returns the path of the first field in value that does not
+// exist in typ, or "" if there is none. Values of the wrong type are left to
+// json.Unmarshal to report.
+func unknownField(typ reflect.Type, value interface{}, path string) string {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if reflect.PtrTo(typ).Implements(unmarshalerType) {
+		return ""
+	}
+	switch typ.Kind() {
+	case reflect.Struct:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		fields := jsonFields(typ)
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+			fieldType, found := fields[name]
+			if !found {
+				return fieldPath
+			}
+			if p := unknownField(fieldType, obj[name], fieldPath); p != "" {
+				return p
+			}
+		}
+	case reflect.Slice:
+		arr, ok := value.([]interface{})
+		if !ok {
+			return ""
+		}
+		for i, v := range arr {
+			if p := unknownField(typ.Elem(), v, fmt.Sprintf("%s[%d]", path, i)); p != "" {
+				return p
+			}
+		}
+	case reflect.Map:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		for k, v := range obj {
+			if p := unknownField(typ.Elem(), v, fmt.Sprintf("%s[%s]", path, k)); p != "" {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+// jsonFields returns the type of every field of typ by its JSON name,
+// including the fields of inlined structs.
+func jsonFields(typ reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			for k, v := range jsonFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
@@ -0,0 +1,108 @@
+package v1alpha1
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{
+			name: "valid",
+			data: `
+apiVersion: kloader.appscode.com/v1alpha1
+kind: LoaderConfiguration
+sources:
+- configMap:
+    name: nginx
+  mountPath: /etc/nginx
+  modes:
+    nginx.conf: 0644
+  items:
+  - key: nginx.conf
+    path: conf/nginx.conf
+- resource:
+    version: v1
+    resource: services
+    name: web
+    fields:
+    - jsonPath: "{.spec.clusterIP}"
+      key: ip
+  mountPath: /etc/web
+hook:
+  command: nginx -s reload
+  timeout: 1m
+`,
+		},
+		{
+			name: "misspelled source field",
+			data: `
+sources:
+- configMap:
+    name: nginx
+  mountPaht: /etc/nginx
+`,
+			err: "unknown field sources[0].mountPaht",
+		},
+		{
+			name: "unknown nested field",
+			data: `
+sources:
+- configMap:
+    name: nginx
+  mountPath: /etc/nginx
+  items:
+  - key: a
+    pth: b
+`,
+			err: "unknown field sources[0].items[0].pth",
+		},
+		{
+			name: "unknown field of an inlined struct",
+			data: `
+sources:
+- endpoints:
+    name: web
+    namespce: default
+  mountPath: /etc/web
+`,
+			err: "unknown field sources[0].endpoints.namespce",
+		},
+		{
+			name: "unknown top-level field",
+			data: `
+hooks:
+  command: true
+`,
+			err: "unknown field hooks",
+		},
+		{
+			name: "field names are case sensitive",
+			data: `
+sources:
+- configMap:
+    name: nginx
+  mountpath: /etc/nginx
+`,
+			err: "unknown field sources[0].mountpath",
+		},
+	}
+	for _, c := range cases {
+		cfg, err := Decode([]byte(c.data))
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", c.name, err)
+			} else if cfg == nil {
+				t.Errorf("%s: expected a configuration", c.name)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error %q, found %v", c.name, c.err, err)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	GroupName                       = "kloader.appscode.com"
+	ResourceKindLoaderConfiguration = "LoaderConfiguration"
+)
+
+var SchemeGroupVersion = schema.GroupVersion{Group: GroupName, Version: "v1alpha1"}
+
+// LoaderConfiguration is the format of the file passed to kloader via --config.
+type LoaderConfiguration struct {
+	metav1.TypeMeta `json:",inline,omitempty"`
+
+	// Sources lists the ConfigMaps and Secrets that are projected into the pod.
+	Sources []Source `json:"sources,omitempty"`
+	// Hook is run after a set of changes to the sources has been mounted.
+	Hook *Hook `json:"hook,omitempty"`
+	// SignalProcess is signalled after a set of changes to the sources has
+	// been mounted, after Hook has run.
+	SignalProcess *SignalProcess `json:"signalProcess,omitempty"`
+	// Webhook is called after a set of changes to the sources has been
+	// mounted, after SignalProcess was signalled.
+	Webhook *Webhook `json:"webhook,omitempty"`
+	// OnDelete decides what happens to the mounted files when a source is deleted.
+	OnDelete *OnDelete `json:"onDelete,omitempty"`
+	// ResyncPeriod is how often the sources are re-listed. Defaults to 5m.
+	ResyncPeriod *metav1.Duration `json:"resyncPeriod,omitempty"`
+	// Debounce collapses a burst of updates to a source into a single mount.
+	Debounce *Debounce `json:"debounce,omitempty"`
+	// RecordEvents creates Events on the sources, and on the kloader pod if
+	// the POD_NAME environment variable is set. Defaults to true.
+	RecordEvents *bool `json:"recordEvents,omitempty"`
+	// MetricsAddress is the address /metrics is served on, like :8080.
+	// Nothing is served if empty. Changing it requires a restart.
+	MetricsAddress string `json:"metricsAddress,omitempty"`
+	// ProbeAddress is the address /healthz and /readyz are served on, like
+	// :8081. Nothing is served if empty. Changing it requires a restart.
+	ProbeAddress string `json:"probeAddress,omitempty"`
+}
+
+// Source is a single ConfigMap, Secret or other object and the directory it
+// is mounted into. Exactly one of ConfigMap, Secret, Resource or Endpoints
+// must be set.
+type Source struct {
+	ConfigMap *ObjectReference `json:"configMap,omitempty"`
+	Secret    *ObjectReference `json:"secret,omitempty"`
+	// Resource projects fields of an object of any other resource, like a
+	// custom resource or the annotations of a Service.
+	Resource *ResourceReference `json:"resource,omitempty"`
+	// Endpoints renders the ready addresses of a Service into a file.
+	Endpoints *EndpointsReference `json:"endpoints,omitempty"`
+	// MountPath is the directory the keys of the source are written into.
+	MountPath string `json:"mountPath"`
+
+	// DefaultMode is the mode of the projected files, unless overridden in
+	// Modes. Defaults to 0777 for a ConfigMap, 0400 for a Secret and 0644
+	// for a Resource or Endpoints.
+	DefaultMode *int32 `json:"defaultMode,omitempty"`
+	// Modes overrides DefaultMode for individual keys.
+	Modes map[string]int32 `json:"modes,omitempty"`
+	// UID and GID own the projected files, if set.
+	UID *int64 `json:"uid,omitempty"`
+	GID *int64 `json:"gid,omitempty"`
+
+	// Include and Exclude select the keys that are projected. A pattern is a
+	// glob, or a regular expression if prefixed with "re:". If Include is
+	// empty, every key not matched by Exclude is selected.
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	// Items maps selected keys to relative paths. If set, only the listed
+	// keys are projected and each of them must exist in the source.
+	Items []KeyToPath `json:"items,omitempty"`
+
+	// Require holds back mounting the source until it is complete.
+	Require *Requirements `json:"require,omitempty"`
+	// Template renders keys as Go templates before they are written.
+	Template *Template `json:"template,omitempty"`
+	// Output writes the selected keys into a single file instead of one file per key.
+	Output *Output `json:"output,omitempty"`
+	// Validate checks the files of the source before they are written. If
+	// they are rejected, the mounted files are left in place.
+	Validate *Validation `json:"validate,omitempty"`
+	// WriteBack updates the source when its files are changed locally.
+	WriteBack *WriteBack `json:"writeBack,omitempty"`
+}
+
+// WriteBack updates a ConfigMap or Secret from the files in its MountPath,
+// like those written by an admin UI or a certificate renewal script. It is
+// only supported for a source selected by name without Items, Output or
+// Template, so that every file is a key. An update is rejected if the source
+// was changed in the cluster since it was mounted, and the files are then
+// replaced with the version in the cluster.
+type WriteBack struct {
+	// Delay is how long no file may change before the files are written back,
+	// so that half-written files are not. Defaults to 1s.
+	Delay *metav1.Duration `json:"delay,omitempty"`
+	// CreateKeys adds the files that are not keys yet, if they are selected
+	// by Include and Exclude. Otherwise only existing keys are updated.
+	CreateKeys bool `json:"createKeys,omitempty"`
+	// DeleteKeys removes the keys whose files were deleted.
+	DeleteKeys bool `json:"deleteKeys,omitempty"`
+}
+
+// Validation rejects the files of a source that would break the application.
+// A rejected resourceVersion is not mounted again.
+type Validation struct {
+	// JSON and YAML select the files whose syntax is checked, by their path
+	// relative to MountPath. A pattern is a glob, or a regular expression if
+	// prefixed with "re:".
+	JSON []string `json:"json,omitempty"`
+	YAML []string `json:"yaml,omitempty"`
+	// Command is run by `sh -c` in a staging directory that holds the new
+	// files, also passed as $KLOADER_STAGING_DIR. The files are rejected if
+	// it exits non-zero.
+	Command string `json:"command,omitempty"`
+	// Timeout limits how long Command may run. Defaults to 1m.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+type OutputFormat string
+
+const (
+	OutputFormatDotenv     OutputFormat = "dotenv"
+	OutputFormatJSON       OutputFormat = "json"
+	OutputFormatYAML       OutputFormat = "yaml"
+	OutputFormatProperties OutputFormat = "properties"
+	OutputFormatTOML       OutputFormat = "toml"
+)
+
+type KeyTransform string
+
+const (
+	KeyTransformNone  KeyTransform = ""
+	KeyTransformUpper KeyTransform = "upper"
+	KeyTransformLower KeyTransform = "lower"
+	// KeyTransformEnv upper-cases a key and replaces every character that is
+	// not allowed in an environment variable name with an underscore.
+	KeyTransformEnv KeyTransform = "env"
+)
+
+// Output aggregates the selected keys of a source into a single file.
+type Output struct {
+	Format OutputFormat `json:"format"`
+	// File is the path of the file relative to MountPath. Defaults to .env,
+	// config.json, config.yaml, application.properties or config.toml.
+	File string `json:"file,omitempty"`
+	// KeyPrefix is prepended to every key after KeyTransform.
+	KeyPrefix    string       `json:"keyPrefix,omitempty"`
+	KeyTransform KeyTransform `json:"keyTransform,omitempty"`
+}
+
+// Template selects the keys that are rendered with text/template. See the
+// README for the available data and functions.
+type Template struct {
+	// Suffix marks the keys that are rendered. It is removed from the name of
+	// the file, unless the key is mapped to a path by Items. Defaults to ".tmpl".
+	Suffix string `json:"suffix,omitempty"`
+	// DownwardAPIDir is a downwardAPI volume with the files labels and
+	// annotations of the pod, used for .Pod.Labels and .Pod.Annotations.
+	DownwardAPIDir string `json:"downwardAPIDir,omitempty"`
+	// Namespaces that the configmap and secret functions may read from,
+	// besides the namespace of the source.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Env enables the env and expandenv functions, which expose the
+	// environment of kloader.
+	Env bool `json:"env,omitempty"`
+}
+
+// Requirements must all be met by a source before any of its files are written.
+type Requirements struct {
+	// Keys that must exist in the data of the source.
+	Keys []string `json:"keys,omitempty"`
+	// Annotations and Labels that must be set on the source, with these values.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// KeyToPath maps a key of the source to a relative path in the mount directory.
+type KeyToPath struct {
+	Key string `json:"key"`
+	// Path may contain subdirectories, but must not be absolute, contain
+	// '..' or start with '..'.
+	Path string `json:"path"`
+	// Mode overrides the mode of this file.
+	Mode *int32 `json:"mode,omitempty"`
+}
+
+// ObjectReference selects a single object by Name, or every object matching
+// Selector. Exactly one of them must be set.
+type ObjectReference struct {
+	Name string `json:"name,omitempty"`
+	// Namespace defaults to the namespace of the kloader pod.
+	Namespace string `json:"namespace,omitempty"`
+	// Selector is a label selector, like app=gateway. Every matching object is
+	// mounted into a subdirectory of MountPath named after it, which is removed
+	// once the object is deleted or no longer matches.
+	Selector string `json:"selector,omitempty"`
+}
+
+// ResourceReference selects objects of a namespaced resource, and the fields
+// of them that are projected.
+type ResourceReference struct {
+	// Group is empty for the core API group.
+	Group   string `json:"group,omitempty"`
+	Version string `json:"version"`
+	// Resource is the lower-case plural name, like ingresses.
+	Resource        string `json:"resource"`
+	ObjectReference `json:",inline"`
+	// Fields are projected as the keys of the source.
+	Fields []FieldToKey `json:"fields"`
+}
+
+// FieldToKey projects the value at a JSONPath as a key.
+type FieldToKey struct {
+	// JSONPath selects a value with the JSONPath of kubectl, like
+	// {.spec.config} or {.metadata.annotations.example\.com/config}. A string
+	// is written as is, any other value as JSON, and several values as a JSON
+	// array. The key is missing if the value is.
+	JSONPath string `json:"jsonPath"`
+	// Key names the value, and the file unless it is mapped by Items.
+	Key string `json:"key"`
+}
+
+// EndpointsReference selects the Endpoints of a Service by Name, or of every
+// Service matching Selector, and the template they are rendered with.
+// Exactly one of Template or TemplateFile must be set.
+type EndpointsReference struct {
+	ObjectReference `json:",inline"`
+	// Template is a text/template executed with the ready addresses and
+	// ports. See the README for the available fields.
+	Template string `json:"template,omitempty"`
+	// TemplateFile contains the template. It is read once on start.
+	TemplateFile string `json:"templateFile,omitempty"`
+	// File is the path of the rendered file relative to MountPath. Defaults
+	// to endpoints.
+	File string `json:"file,omitempty"`
+}
+
+type Hook struct {
+	// Command is run by `sh -c` after the sources have been mounted. It is
+	// retried with backoff if it exits non-zero.
+	Command string `json:"command,omitempty"`
+	// Timeout limits how long Command and OnDelete.Command may run. Defaults to 1m.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// RollbackOnFailure restores the files mounted before the changes if
+	// Command exits non-zero, instead of retrying it. The rejected
+	// resourceVersions are not mounted again until the sources change.
+	RollbackOnFailure bool `json:"rollbackOnFailure,omitempty"`
+	// RerunAfterRollback runs Command again after the files were restored.
+	RerunAfterRollback bool `json:"rerunAfterRollback,omitempty"`
+}
+
+// SignalProcess selects a process in the shared process namespace of the pod.
+// Exactly one of Name, PIDFile or Cgroup must be set.
+type SignalProcess struct {
+	// Name is matched against /proc/<pid>/comm and the base name of argv[0].
+	Name string `json:"name,omitempty"`
+	// PIDFile contains the pid of the process.
+	PIDFile string `json:"pidFile,omitempty"`
+	// Cgroup selects every process whose /proc/<pid>/cgroup lists a path
+	// that contains it as whole components. An absolute path, like
+	// /kubepods/pod1, must match from the root, a relative one, like a
+	// container ID, may match anywhere.
+	Cgroup string `json:"cgroup,omitempty"`
+	// Signal is one of HUP, INT, QUIT, USR1, USR2, TERM or WINCH, with or
+	// without the SIG prefix. Defaults to HUP.
+	Signal string `json:"signal,omitempty"`
+}
+
+// Webhook is an HTTP endpoint that makes the application reload, like the
+// /-/reload endpoint of Prometheus.
+type Webhook struct {
+	URL string `json:"url"`
+	// Method defaults to POST.
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Body is a text/template executed with the changed sources. See the
+	// README for the available fields.
+	Body string `json:"body,omitempty"`
+	// CAFile contains the PEM encoded certificates used to verify the server,
+	// instead of the system roots.
+	CAFile                string `json:"caFile,omitempty"`
+	InsecureSkipTLSVerify bool   `json:"insecureSkipTLSVerify,omitempty"`
+	// ExpectedStatusCodes defaults to any 2xx status.
+	ExpectedStatusCodes []int `json:"expectedStatusCodes,omitempty"`
+	// Timeout of a single request. Defaults to 10s.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+type Debounce struct {
+	// QuietPeriod is how long no update must arrive before a source is
+	// mounted. Updates are not delayed if zero.
+	QuietPeriod *metav1.Duration `json:"quietPeriod,omitempty"`
+	// MaxWait limits how long a source is not mounted during a continuous
+	// burst of updates. Not limited if zero.
+	MaxWait *metav1.Duration `json:"maxWait,omitempty"`
+}
+
+type DeletePolicy string
+
+const (
+	// DeletePolicyKeep leaves the mounted files in place.
+	DeletePolicyKeep DeletePolicy = "keep"
+	// DeletePolicyClear removes all files projected from the deleted source.
+	DeletePolicyClear DeletePolicy = "clear"
+	// DeletePolicyHook leaves the mounted files in place and runs OnDelete.Command.
+	DeletePolicyHook DeletePolicy = "hook"
+)
+
+type OnDelete struct {
+	// Policy defaults to keep.
+	Policy DeletePolicy `json:"policy,omitempty"`
+	// Command is run by `sh -c` when a source is deleted, if Policy is hook.
+	Command string `json:"command,omitempty"`
+}
@@ -0,0 +1,439 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"text/template"
+	"text/template/parse"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// RegexpPrefix marks an Include or Exclude pattern as a regular expression.
+const RegexpPrefix = "re:"
+
+func (c LoaderConfiguration) IsValid() error {
+	if c.APIVersion != SchemeGroupVersion.String() {
+		return fmt.Errorf("apiVersion must be %s, found %q", SchemeGroupVersion, c.APIVersion)
+	}
+	if c.Kind != ResourceKindLoaderConfiguration {
+		return fmt.Errorf("kind must be %s, found %q", ResourceKindLoaderConfiguration, c.Kind)
+	}
+	if len(c.Sources) == 0 {
+		return fmt.Errorf("a ConfigMap/Secret/Resource/Endpoints source is required, but not provided")
+	}
+
+	if sp := c.SignalProcess; sp != nil {
+		set := 0
+		for _, v := range []string{sp.Name, sp.PIDFile, sp.Cgroup} {
+			if v != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return fmt.Errorf("signalProcess: exactly one of name, pidFile or cgroup is required")
+		}
+		if _, found := ParseSignal(sp.Signal); !found {
+			return fmt.Errorf("signalProcess: unsupported signal %s", sp.Signal)
+		}
+	}
+
+	if w := c.Webhook; w != nil {
+		u, err := url.Parse(w.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook: url must be an absolute http or https URL, found %q", w.URL)
+		}
+		if _, err := template.New("body").Parse(w.Body); err != nil {
+			return fmt.Errorf("webhook: invalid body template, cause %v", err)
+		}
+		for _, code := range w.ExpectedStatusCodes {
+			if code < 100 || code > 599 {
+				return fmt.Errorf("webhook: invalid expected status code %d", code)
+			}
+		}
+	}
+
+	if d := c.Debounce; d != nil {
+		if d.QuietPeriod != nil && d.QuietPeriod.Duration < 0 {
+			return fmt.Errorf("debounce: quietPeriod must not be negative")
+		}
+		if d.MaxWait != nil && d.MaxWait.Duration < 0 {
+			return fmt.Errorf("debounce: maxWait must not be negative")
+		}
+		if d.QuietPeriod != nil && d.MaxWait != nil && d.MaxWait.Duration > 0 && d.MaxWait.Duration < d.QuietPeriod.Duration {
+			return fmt.Errorf("debounce: maxWait must not be shorter than quietPeriod")
+		}
+	}
+
+	if c.OnDelete != nil {
+		switch c.OnDelete.Policy {
+		case "", DeletePolicyKeep, DeletePolicyClear:
+		case DeletePolicyHook:
+			if c.OnDelete.Command == "" {
+				return fmt.Errorf("onDelete: command is required for policy %s, but not provided", DeletePolicyHook)
+			}
+		default:
+			return fmt.Errorf("onDelete: policy must be one of %s, %s or %s, found %q", DeletePolicyKeep, DeletePolicyClear, DeletePolicyHook, c.OnDelete.Policy)
+		}
+	}
+
+	mountPaths := map[string]int{}
+	// objects holds the index of the source of every named object, by kind, namespace and name
+	objects := map[string]int{}
+	for i, src := range c.Sources {
+		var ref *ObjectReference
+		set := 0
+		for _, r := range []*ObjectReference{src.ConfigMap, src.Secret} {
+			if r != nil {
+				ref = r
+				set++
+			}
+		}
+		if src.Resource != nil {
+			if err := validateResource(*src.Resource); err != nil {
+				return fmt.Errorf("sources[%d]: resource: %v", i, err)
+			}
+			ref = &src.Resource.ObjectReference
+			set++
+		}
+		if e := src.Endpoints; e != nil {
+			if (e.Template == "") == (e.TemplateFile == "") {
+				return fmt.Errorf("sources[%d]: endpoints: exactly one of template or templateFile is required", i)
+			}
+			if err := validateEndpointsTemplate(*e); err != nil {
+				return fmt.Errorf("sources[%d]: endpoints: %v", i, err)
+			}
+			if e.File != "" {
+				if err := validateItemPath(e.File); err != nil {
+					return fmt.Errorf("sources[%d]: endpoints file: %v", i, err)
+				}
+			}
+			ref = &e.ObjectReference
+			set++
+		}
+		switch set {
+		case 0:
+			return fmt.Errorf("sources[%d]: ConfigMap/Secret/Resource/Endpoints is required, but not provided", i)
+		case 1:
+		default:
+			return fmt.Errorf("sources[%d]: exactly one of ConfigMap, Secret, Resource or Endpoints is required", i)
+		}
+		switch {
+		case ref.Name != "" && ref.Selector != "":
+			return fmt.Errorf("sources[%d]: either name or selector is required, but both are provided", i)
+		case ref.Selector != "":
+			if _, err := labels.Parse(ref.Selector); err != nil {
+				return fmt.Errorf("sources[%d]: invalid selector %q, cause %v", i, ref.Selector, err)
+			}
+		case ref.Name == "":
+			return fmt.Errorf("sources[%d]: name is required, but not provided", i)
+		default:
+			object := sourceKind(src) + " " + ref.Name
+			if ref.Namespace != "" {
+				object = sourceKind(src) + " " + ref.Namespace + "/" + ref.Name
+			}
+			if j, found := objects[object]; found {
+				return fmt.Errorf("sources[%d]: %s is already mounted by sources[%d]", i, object, j)
+			}
+			objects[object] = i
+		}
+
+		if src.MountPath == "" {
+			return fmt.Errorf("sources[%d]: mountPath is required, but not provided", i)
+		}
+		mountPath := filepath.Clean(src.MountPath)
+		if j, found := mountPaths[mountPath]; found {
+			return fmt.Errorf("sources[%d]: mountPath %s is already used by sources[%d]", i, mountPath, j)
+		}
+		for other, j := range mountPaths {
+			if isNestedPath(mountPath, other) || isNestedPath(other, mountPath) {
+				return fmt.Errorf("sources[%d]: mountPath %s must not be nested with the mountPath %s of sources[%d]", i, mountPath, other, j)
+			}
+		}
+		mountPaths[mountPath] = i
+
+		if src.DefaultMode != nil && !isValidMode(*src.DefaultMode) {
+			return fmt.Errorf("sources[%d]: defaultMode must be between 0 and 0777, found %#o", i, *src.DefaultMode)
+		}
+		for key, mode := range src.Modes {
+			if !isValidMode(mode) {
+				return fmt.Errorf("sources[%d]: mode of key %s must be between 0 and 0777, found %#o", i, key, mode)
+			}
+		}
+		if src.UID != nil && *src.UID < 0 {
+			return fmt.Errorf("sources[%d]: uid must not be negative", i)
+		}
+		if src.GID != nil && *src.GID < 0 {
+			return fmt.Errorf("sources[%d]: gid must not be negative", i)
+		}
+
+		for _, pattern := range append(append([]string{}, src.Include...), src.Exclude...) {
+			if err := validatePattern(pattern); err != nil {
+				return fmt.Errorf("sources[%d]: %v", i, err)
+			}
+		}
+		paths := map[string]string{}
+		for _, item := range src.Items {
+			if item.Key == "" {
+				return fmt.Errorf("sources[%d]: key of item is required, but not provided", i)
+			}
+			if err := validateItemPath(item.Path); err != nil {
+				return fmt.Errorf("sources[%d]: item %s: %v", i, item.Key, err)
+			}
+			if key, found := paths[path.Clean(item.Path)]; found {
+				return fmt.Errorf("sources[%d]: keys %s and %s are both mapped to %s", i, key, item.Key, item.Path)
+			}
+			paths[path.Clean(item.Path)] = item.Key
+			if item.Mode != nil && !isValidMode(*item.Mode) {
+				return fmt.Errorf("sources[%d]: mode of item %s must be between 0 and 0777, found %#o", i, item.Key, *item.Mode)
+			}
+		}
+		if out := src.Output; out != nil {
+			switch out.Format {
+			case OutputFormatDotenv, OutputFormatJSON, OutputFormatYAML, OutputFormatProperties, OutputFormatTOML:
+			default:
+				return fmt.Errorf("sources[%d]: output format must be one of %s, %s, %s, %s or %s, found %q", i,
+					OutputFormatDotenv, OutputFormatJSON, OutputFormatYAML, OutputFormatProperties, OutputFormatTOML, out.Format)
+			}
+			switch out.KeyTransform {
+			case KeyTransformNone, KeyTransformUpper, KeyTransformLower, KeyTransformEnv:
+			default:
+				return fmt.Errorf("sources[%d]: output keyTransform must be one of %s, %s or %s, found %q", i,
+					KeyTransformUpper, KeyTransformLower, KeyTransformEnv, out.KeyTransform)
+			}
+			if out.File != "" {
+				if err := validateItemPath(out.File); err != nil {
+					return fmt.Errorf("sources[%d]: output file: %v", i, err)
+				}
+			}
+		}
+		if v := src.Validate; v != nil {
+			for _, pattern := range append(append([]string{}, v.JSON...), v.YAML...) {
+				if err := validatePattern(pattern); err != nil {
+					return fmt.Errorf("sources[%d]: validate: %v", i, err)
+				}
+			}
+			if v.Timeout != nil && v.Timeout.Duration < 0 {
+				return fmt.Errorf("sources[%d]: validate: timeout must not be negative", i)
+			}
+		}
+		if wb := src.WriteBack; wb != nil {
+			switch {
+			case src.ConfigMap == nil && src.Secret == nil:
+				return fmt.Errorf("sources[%d]: writeBack is only supported for a ConfigMap or Secret", i)
+			case ref.Selector != "":
+				return fmt.Errorf("sources[%d]: writeBack is not supported with a selector", i)
+			case len(src.Items) > 0 || src.Output != nil || src.Template != nil:
+				return fmt.Errorf("sources[%d]: writeBack is not supported with items, output or template", i)
+			case wb.Delay != nil && wb.Delay.Duration < 0:
+				return fmt.Errorf("sources[%d]: writeBack: delay must not be negative", i)
+			}
+		}
+		if src.Require != nil {
+			for _, key := range src.Require.Keys {
+				if key == "" {
+					return fmt.Errorf("sources[%d]: required keys must not be empty", i)
+				}
+			}
+			for k := range src.Require.Annotations {
+				if k == "" {
+					return fmt.Errorf("sources[%d]: required annotations must have a name", i)
+				}
+			}
+			for k := range src.Require.Labels {
+				if k == "" {
+					return fmt.Errorf("sources[%d]: required labels must have a name", i)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// sourceKind returns the kind of the object of src, with the resource,
+// version and group for a Resource.
+func sourceKind(src Source) string {
+	switch {
+	case src.ConfigMap != nil:
+		return "ConfigMap"
+	case src.Secret != nil:
+		return "Secret"
+	case src.Resource != nil && src.Resource.Group == "":
+		return src.Resource.Resource + "." + src.Resource.Version
+	case src.Resource != nil:
+		return src.Resource.Resource + "." + src.Resource.Version + "." + src.Resource.Group
+	default:
+		return "Endpoints"
+	}
+}
+
+func validateResource(r ResourceReference) error {
+	if r.Version == "" {
+		return fmt.Errorf("version is required, but not provided")
+	}
+	if r.Resource == "" || strings.ContainsAny(r.Resource, "/.") {
+		return fmt.Errorf("resource must be the plural name of a resource, found %q", r.Resource)
+	}
+	if len(r.Fields) == 0 {
+		return fmt.Errorf("fields are required, but not provided")
+	}
+	keys := map[string]bool{}
+	for _, field := range r.Fields {
+		if _, err := ParseJSONPath(field.JSONPath); err != nil {
+			return err
+		}
+		if err := validateItemPath(field.Key); err != nil {
+			return fmt.Errorf("key of %s: %v", field.JSONPath, err)
+		}
+		if keys[field.Key] {
+			return fmt.Errorf("key %s is used by more than one field", field.Key)
+		}
+		keys[field.Key] = true
+	}
+	return nil
+}
+
+// validateEndpointsTemplate parses the template of e, read from its
+// TemplateFile if set. Functions are not checked, since they are only known
+// to the controller.
+func validateEndpointsTemplate(e EndpointsReference) error {
+	text := e.Template
+	if e.TemplateFile != "" {
+		data, err := ioutil.ReadFile(e.TemplateFile)
+		if err != nil {
+			return fmt.Errorf("failed to read templateFile, cause %v", err)
+		}
+		text = string(data)
+	}
+	tree := parse.New("endpoints")
+	tree.Mode = parse.SkipFuncCheck
+	if _, err := tree.Parse(text, "", "", map[string]*parse.Tree{}); err != nil {
+		return fmt.Errorf("invalid template, cause %v", err)
+	}
+	return nil
+}
+
+func validatePattern(pattern string) error {
+	if strings.HasPrefix(pattern, RegexpPrefix) {
+		if _, err := regexp.Compile(strings.TrimPrefix(pattern, RegexpPrefix)); err != nil {
+			return fmt.Errorf("invalid pattern %q, cause %v", pattern, err)
+		}
+		return nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q, cause %v", pattern, err)
+	}
+	return nil
+}
+
+func validateItemPath(p string) error {
+	if p == "" {
+		return fmt.Errorf("path is required, but not provided")
+	}
+	if path.IsAbs(p) {
+		return fmt.Errorf("path %s must be relative", p)
+	}
+	items := strings.Split(p, "/")
+	for _, item := range items {
+		if item == ".." {
+			return fmt.Errorf("path %s must not contain '..'", p)
+		}
+	}
+	if strings.HasPrefix(items[0], "..") {
+		return fmt.Errorf("path %s must not start with '..'", p)
+	}
+	return nil
+}
+
+// signals holds the signals a process can be sent, by name without the SIG prefix.
+var signals = map[string]syscall.Signal{
+	"HUP":   syscall.SIGHUP,
+	"INT":   syscall.SIGINT,
+	"QUIT":  syscall.SIGQUIT,
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"TERM":  syscall.SIGTERM,
+	"WINCH": syscall.SIGWINCH,
+}
+
+// ParseSignal returns the signal of SignalProcess.Signal, named with or
+// without the SIG prefix. An empty name is HUP.
+func ParseSignal(name string) (syscall.Signal, bool) {
+	if name == "" {
+		return syscall.SIGHUP, true
+	}
+	signal, found := signals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	return signal, found
+}
+
+// ParseJSONPath parses the JSONPath of a FieldToKey like kubectl does, with
+// optional surrounding braces. A missing field selects no value instead of
+// failing. Quoted keys are rejected, since the parser would read them as
+// fields silently, and so are negative array indices, which the parser of
+// the vendored client-go does not evaluate correctly.
+func ParseJSONPath(expr string) (*jsonpath.JSONPath, error) {
+	text := strings.TrimSpace(expr)
+	if strings.Contains(text, "['") || strings.Contains(text, `["`) {
+		return nil, fmt.Errorf(`invalid JSONPath %q, quoted keys are not supported, escape the dots of a key instead, like {.metadata.annotations.example\.com/config}`, expr)
+	}
+	if !strings.HasPrefix(text, "{") {
+		text = "{" + text + "}"
+	}
+	parser, err := jsonpath.Parse("jsonPath", text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSONPath %q, cause %v", expr, err)
+	}
+	if negativeIndex(parser.Root) {
+		return nil, fmt.Errorf("invalid JSONPath %q, negative array indices are not supported", expr)
+	}
+	p := jsonpath.New("jsonPath").AllowMissingKeys(true)
+	if err := p.Parse(text); err != nil {
+		return nil, fmt.Errorf("invalid JSONPath %q, cause %v", expr, err)
+	}
+	return p, nil
+}
+
+func negativeIndex(node jsonpath.Node) bool {
+	switch n := node.(type) {
+	case *jsonpath.ListNode:
+		for _, child := range n.Nodes {
+			if negativeIndex(child) {
+				return true
+			}
+		}
+	case *jsonpath.ArrayNode:
+		for _, param := range n.Params {
+			if param.Known && param.Value < 0 {
+				return true
+			}
+		}
+	case *jsonpath.FilterNode:
+		return negativeIndex(n.Left) || negativeIndex(n.Right)
+	case *jsonpath.UnionNode:
+		for _, list := range n.Nodes {
+			if negativeIndex(list) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isNestedPath reports whether the clean path p is inside the directory dir.
+func isNestedPath(p, dir string) bool {
+	if dir == string(filepath.Separator) {
+		return p != dir
+	}
+	return strings.HasPrefix(p, dir+string(filepath.Separator))
+}
+
+func isValidMode(mode int32) bool {
+	return mode >= 0 && mode <= 0777
+}
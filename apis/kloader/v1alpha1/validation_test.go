@@ -0,0 +1,214 @@
+package v1alpha1
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIsValidSources(t *testing.T) {
+	configMap := func(ns, name, mountPath string) Source {
+		return Source{ConfigMap: &ObjectReference{Namespace: ns, Name: name}, MountPath: mountPath}
+	}
+	secret := func(ns, name, mountPath string) Source {
+		return Source{Secret: &ObjectReference{Namespace: ns, Name: name}, MountPath: mountPath}
+	}
+	resource := func(version, name, mountPath string) Source {
+		return Source{Resource: &ResourceReference{
+			ObjectReference: ObjectReference{Name: name},
+			Group:           "example.com",
+			Version:         version,
+			Resource:        "gateways",
+			Fields:          []FieldToKey{{JSONPath: "{.spec}", Key: "spec.json"}},
+		}, MountPath: mountPath}
+	}
+	cases := []struct {
+		name    string
+		sources []Source
+		err     string
+	}{
+		{
+			name:    "distinct objects",
+			sources: []Source{configMap("", "app", "/a"), configMap("", "db", "/b"), configMap("other", "app", "/c")},
+		},
+		{
+			name:    "ConfigMap and Secret of the same name",
+			sources: []Source{configMap("", "app", "/a"), secret("", "app", "/b")},
+		},
+		{
+			name:    "ConfigMap mounted twice",
+			sources: []Source{configMap("", "app", "/a"), configMap("", "app", "/b")},
+			err:     "sources[1]: ConfigMap app is already mounted by sources[0]",
+		},
+		{
+			name:    "Secret mounted twice",
+			sources: []Source{secret("kube-system", "tls", "/a"), configMap("", "app", "/b"), secret("kube-system", "tls", "/c")},
+			err:     "sources[2]: Secret kube-system/tls is already mounted by sources[0]",
+		},
+		{
+			name:    "resource in two versions",
+			sources: []Source{resource("v1", "public", "/a"), resource("v2", "public", "/b")},
+		},
+		{
+			name:    "resource mounted twice",
+			sources: []Source{resource("v1", "public", "/a"), resource("v1", "public", "/b")},
+			err:     "sources[1]: gateways.v1.example.com public is already mounted by sources[0]",
+		},
+		{
+			name:    "mountPath used twice",
+			sources: []Source{configMap("", "app", "/a"), configMap("", "db", "/a/")},
+			err:     "mountPath /a is already used by sources[0]",
+		},
+		{
+			name:    "sibling mountPaths",
+			sources: []Source{configMap("", "app", "/etc/app"), configMap("", "db", "/etc/app-db")},
+		},
+		{
+			name:    "mountPath inside another",
+			sources: []Source{{ConfigMap: &ObjectReference{Selector: "app=web"}, MountPath: "/etc/sites"}, configMap("", "db", "/etc/sites/db")},
+			err:     "sources[1]: mountPath /etc/sites/db must not be nested with the mountPath /etc/sites of sources[0]",
+		},
+		{
+			name:    "mountPath containing another",
+			sources: []Source{configMap("", "db", "/etc/sites/db/"), configMap("", "app", "/etc/sites")},
+			err:     "sources[1]: mountPath /etc/sites must not be nested with the mountPath /etc/sites/db of sources[0]",
+		},
+		{
+			name:    "root mountPath",
+			sources: []Source{configMap("", "app", "/"), configMap("", "db", "/etc")},
+			err:     "must not be nested",
+		},
+	}
+	for _, c := range cases {
+		cfg := LoaderConfiguration{
+			TypeMeta: metav1.TypeMeta{APIVersion: SchemeGroupVersion.String(), Kind: ResourceKindLoaderConfiguration},
+			Sources:  c.sources,
+		}
+		err := cfg.IsValid()
+		if c.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		} else if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s: expected error %q, found %v", c.name, c.err, err)
+		}
+	}
+}
+
+func TestIsValidEndpointsTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kloader-validation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	unclosedFile := filepath.Join(dir, "unclosed.tmpl")
+	if err := ioutil.WriteFile(unclosedFile, []byte("{{ range .Backends }}{{ .IP }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	validFile := filepath.Join(dir, "valid.tmpl")
+	if err := ioutil.WriteFile(validFile, []byte("{{ range .Backends }}{{ .IP }}\n{{ end }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name      string
+		endpoints EndpointsReference
+		err       string
+	}{
+		{
+			name:      "valid template",
+			endpoints: EndpointsReference{Template: "{{ range .Backends }}server {{ .IP }}:{{ .Port }};\n{{ end }}"},
+		},
+		{
+			name:      "functions of the controller",
+			endpoints: EndpointsReference{Template: `{{ upper .Name | default "web" }}`},
+		},
+		{
+			name:      "unclosed action",
+			endpoints: EndpointsReference{Template: "{{ .Backends "},
+			err:       "sources[0]: endpoints: invalid template",
+		},
+		{
+			name:      "unclosed range",
+			endpoints: EndpointsReference{Template: "{{ range .Backends }}{{ .IP }}"},
+			err:       "sources[0]: endpoints: invalid template",
+		},
+		{
+			name:      "valid templateFile",
+			endpoints: EndpointsReference{TemplateFile: validFile},
+		},
+		{
+			name:      "invalid templateFile",
+			endpoints: EndpointsReference{TemplateFile: unclosedFile},
+			err:       "sources[0]: endpoints: invalid template",
+		},
+		{
+			name:      "missing templateFile",
+			endpoints: EndpointsReference{TemplateFile: filepath.Join(dir, "missing.tmpl")},
+			err:       "sources[0]: endpoints: failed to read templateFile",
+		},
+	}
+	for _, c := range cases {
+		e := c.endpoints
+		e.Name = "web"
+		cfg := LoaderConfiguration{
+			TypeMeta: metav1.TypeMeta{APIVersion: SchemeGroupVersion.String(), Kind: ResourceKindLoaderConfiguration},
+			Sources:  []Source{{Endpoints: &e, MountPath: "/etc/web"}},
+		}
+		err := cfg.IsValid()
+		if c.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		} else if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s: expected error %q, found %v", c.name, c.err, err)
+		}
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	cases := []struct {
+		name  string
+		found bool
+	}{
+		{"", true},
+		{"HUP", true},
+		{"SIGUSR1", true},
+		{"sigterm", true},
+		{"winch", true},
+		{"KILL", false},
+		{"SIG", false},
+	}
+	for _, c := range cases {
+		if _, found := ParseSignal(c.name); found != c.found {
+			t.Errorf("%q: expected found %v, found %v", c.name, c.found, found)
+		}
+	}
+}
+
+func TestParseJSONPath(t *testing.T) {
+	cases := []struct {
+		expr string
+		err  string
+	}{
+		{expr: "{.spec.config}"},
+		{expr: ".spec.config"},
+		{expr: "{$.spec.config}"},
+		{expr: `{.metadata.annotations.example\.com/config}`},
+		{expr: "{.spec.ports[*].port}"},
+		{expr: "{.spec.ports[0:2]}"},
+		{expr: "{.metadata.annotations['a]b']}", err: "quoted keys are not supported"},
+		{expr: `{.metadata.annotations["example.com/config"]}`, err: "quoted keys are not supported"},
+		{expr: "{.spec.ports[-1].port}", err: "negative array indices are not supported"},
+		{expr: "{.spec.ports[0}", err: "invalid JSONPath"},
+		{expr: "{.spec", err: "invalid JSONPath"},
+	}
+	for _, c := range cases {
+		_, err := ParseJSONPath(c.expr)
+		if c.err == "" && err != nil {
+			t.Errorf("%q: unexpected error: %v", c.expr, err)
+		} else if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%q: expected error %q, found %v", c.expr, c.err, err)
+		}
+	}
+}
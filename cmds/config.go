@@ -0,0 +1,89 @@
+package cmds
+
+import (
+	"bytes"
+	"io/ioutil"
+	"time"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+	"github.com/appscode/kloader/controller"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+)
+
+const configReloadPeriod = 10 * time.Second
+
+// runController runs a controller for cfg. If a config file is used, the
+// controller is replaced with a new one whenever the file changes on disk.
+// An invalid file is logged and the current controller is kept running.
+func runController(cmd *cobra.Command, config *rest.Config, cfg *v1alpha1.LoaderConfiguration) {
+	ctrl, err := newController(config, cfg)
+	if err != nil {
+		log.Fatalln("Failed to create controller, Cause", err)
+	}
+	r := &controllerRunner{cmd: cmd, config: config}
+	r.start(ctrl)
+
+	if configFile == "" {
+		return
+	}
+	r.last, _ = ioutil.ReadFile(configFile)
+	go wait.Forever(func() {
+		data, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			log.Errorln("Failed to read config file, Cause", err)
+			return
+		}
+		r.reload(data)
+	}, configReloadPeriod)
+}
+
+// controllerRunner runs the controller of the current configuration.
+type controllerRunner struct {
+	cmd    *cobra.Command
+	config *rest.Config
+	// last holds the content of the config file of the running controller.
+	last           []byte
+	ctrl           *controller.Controller
+	stopCh, doneCh chan struct{}
+}
+
+func (r *controllerRunner) start(ctrl *controller.Controller) {
+	r.ctrl = ctrl
+	r.stopCh, r.doneCh = make(chan struct{}), make(chan struct{})
+	setCurrentController(ctrl)
+	go func(stopCh <-chan struct{}, doneCh chan<- struct{}) {
+		defer close(doneCh)
+		ctrl.Run(stopCh)
+	}(r.stopCh, r.doneCh)
+}
+
+// reload replaces the running controller with one for the config file data,
+// and reports whether it did. The new controller is built before the running
+// one is stopped, so that the running one is kept if data is invalid. The new
+// controller inherits the pending changes and rejected versions of the old one.
+func (r *controllerRunner) reload(data []byte) bool {
+	if bytes.Equal(data, r.last) {
+		return false
+	}
+	r.last = data
+
+	newCfg, err := parseConfiguration(r.cmd, data)
+	if err != nil {
+		log.Errorln("Ignoring invalid config file, Cause", err)
+		return false
+	}
+	ctrl, err := newController(r.config, newCfg)
+	if err != nil {
+		log.Errorln("Ignoring config file, Cause", err)
+		return false
+	}
+	log.Infoln("Config file", configFile, "changed, reloading")
+	close(r.stopCh)
+	<-r.doneCh
+	ctrl.Inherit(r.ctrl)
+	r.start(ctrl)
+	return true
+}
@@ -0,0 +1,100 @@
+package cmds
+
+import (
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+const testReloadConfig = `
+apiVersion: kloader.appscode.com/v1alpha1
+kind: LoaderConfiguration
+recordEvents: false
+sources:
+- configMap:
+    name: app
+  mountPath: /etc/app
+`
+
+func TestReloadController(t *testing.T) {
+	cmd, reset := newTestCommand(t, "--config", "kloader.yaml")
+	defer reset()
+	config := &rest.Config{Host: "http://127.0.0.1:1"}
+
+	cfg, err := parseConfiguration(cmd, []byte(testReloadConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctrl, err := newController(config, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &controllerRunner{cmd: cmd, config: config, last: []byte(testReloadConfig)}
+	r.start(ctrl)
+	defer func() {
+		close(r.stopCh)
+		<-r.doneCh
+		setCurrentController(nil)
+	}()
+
+	cases := []struct {
+		name     string
+		data     string
+		reloaded bool
+	}{
+		{
+			name: "unchanged file",
+			data: testReloadConfig,
+		},
+		{
+			name: "invalid file",
+			data: testReloadConfig + "  mountPaht: /etc/app\n",
+		},
+		{
+			name: "valid file whose controller cannot be created",
+			data: testReloadConfig + `
+- endpoints:
+    name: web
+    template: "{{ undefined .Backends }}"
+  mountPath: /etc/web
+`,
+		},
+		{
+			name:     "valid file",
+			data:     testReloadConfig + "debounce:\n  quietPeriod: 1s\n",
+			reloaded: true,
+		},
+	}
+	for _, c := range cases {
+		current.RLock()
+		before := current.ctrl
+		current.RUnlock()
+		stopCh, doneCh := r.stopCh, r.doneCh
+
+		if reloaded := r.reload([]byte(c.data)); reloaded != c.reloaded {
+			t.Errorf("%s: expected reloaded %v, found %v", c.name, c.reloaded, reloaded)
+		}
+		current.RLock()
+		after := current.ctrl
+		current.RUnlock()
+		if !c.reloaded {
+			if after != before {
+				t.Errorf("%s: expected the running controller to be kept", c.name)
+			}
+			select {
+			case <-stopCh:
+				t.Errorf("%s: expected the running controller not to be stopped", c.name)
+			default:
+			}
+			continue
+		}
+		if after == before {
+			t.Errorf("%s: expected the running controller to be replaced", c.name)
+		}
+		select {
+		case <-doneCh:
+		default:
+			t.Errorf("%s: expected the replaced controller to be stopped", c.name)
+		}
+	}
+}
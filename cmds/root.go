@@ -36,6 +36,7 @@ func NewRootCmd(version string) *cobra.Command {
 
 	rootCmd.AddCommand(NewCheckCmd())
 	rootCmd.AddCommand(NewRunCmd())
+	rootCmd.AddCommand(NewSyncCmd())
 	rootCmd.AddCommand(v.NewCmdVersion())
 
 	return rootCmd
@@ -3,50 +3,30 @@ package cmds
 import (
 	"github.com/appscode/go/hold"
 	"github.com/appscode/go/log"
-	"github.com/appscode/kloader/controller"
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
 	"github.com/spf13/cobra"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 func NewRunCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "run",
-		Short: "Run and hold kloader",
+		Use:               "run",
+		Short:             "Run and hold kloader",
 		DisableAutoGenTag: true,
 		Run: func(cmd *cobra.Command, args []string) {
-			if configMap != "" {
-				mounter := controller.NewConfigMapMounter(getRestConfig(), configMap, mountDir, bashFile, resyncPeriod)
-				mounter.Run()
-			} else if secret != "" {
-				mounter := controller.NewSecretMounter(getRestConfig(), secret, mountDir, bashFile, resyncPeriod)
-				mounter.Run()
+			cfg, err := loadConfiguration(cmd)
+			if err != nil {
+				log.Fatalln("Invalid configuration, Cause", err)
 			}
-			hold.Hold()
+			runAndHold(cmd, cfg)
 		},
 	}
 	addFlags(cmd)
 	return cmd
 }
 
-func getRestConfig() *rest.Config {
-	if configMap == "" && secret == "" {
-		log.Fatalln("ConfigMap/Secret is required, but not provided")
-	}
-
-	if configMap != "" && secret != "" {
-		log.Fatalln("Either ConfigMap or Secret is required, but both are provided")
-	}
-
-	if mountDir == "" {
-		log.Fatalln("MountDir is required, but not provided")
-	}
-
-	config, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfigPath)
-	if err != nil {
-		log.Fatalln("Failed to create KubeConfig")
-	}
-	config.Burst = burst
-	config.QPS = qps
-	return config
+// runAndHold keeps syncing the sources of cfg until kloader is stopped.
+func runAndHold(cmd *cobra.Command, cfg *v1alpha1.LoaderConfiguration) {
+	serve(cfg.MetricsAddress, cfg.ProbeAddress)
+	runController(cmd, getRestConfig(), cfg)
+	hold.Hold()
 }
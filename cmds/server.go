@@ -0,0 +1,73 @@
+package cmds
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/kloader/controller"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// current is the running controller, which is replaced when the config file changes.
+var current struct {
+	sync.RWMutex
+	ctrl *controller.Controller
+}
+
+func setCurrentController(ctrl *controller.Controller) {
+	current.Lock()
+	defer current.Unlock()
+	current.ctrl = ctrl
+}
+
+// serve serves the Prometheus metrics on metricsAddr and the /healthz and
+// /readyz probes on probeAddr in the background. Nothing is served on an
+// empty address, and a single server is started if both are the same.
+func serve(metricsAddr, probeAddr string) {
+	muxes := make(map[string]*http.ServeMux)
+	mux := func(addr string) *http.ServeMux {
+		if _, found := muxes[addr]; !found {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+	if metricsAddr != "" {
+		if err := controller.RegisterMetrics(prometheus.DefaultRegisterer); err != nil {
+			log.Fatalln("Failed to register metrics, Cause", err)
+		}
+		mux(metricsAddr).Handle("/metrics", promhttp.Handler())
+		log.Infoln("Serving metrics on", metricsAddr)
+	}
+	if probeAddr != "" {
+		mux(probeAddr).HandleFunc("/healthz", probe((*controller.Controller).Healthy))
+		mux(probeAddr).HandleFunc("/readyz", probe((*controller.Controller).Ready))
+		log.Infoln("Serving health probes on", probeAddr)
+	}
+	for addr, m := range muxes {
+		go func(addr string, m *http.ServeMux) {
+			if err := http.ListenAndServe(addr, m); err != nil {
+				// kloader keeps mounting sources without them
+				log.Errorln("Failed to serve on", addr, "Cause", err)
+			}
+		}(addr, m)
+	}
+}
+
+func probe(check func(*controller.Controller) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		current.RLock()
+		ctrl := current.ctrl
+		current.RUnlock()
+		if ctrl == nil {
+			http.Error(w, "controller is not running", http.StatusServiceUnavailable)
+			return
+		}
+		if err := check(ctrl); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}
+}
@@ -0,0 +1,60 @@
+package cmds
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/appscode/kloader/controller"
+)
+
+func TestProbe(t *testing.T) {
+	cases := []struct {
+		name string
+		ctrl *controller.Controller
+		err  error
+		code int
+		body string
+	}{
+		{
+			name: "no controller",
+			code: http.StatusServiceUnavailable,
+			body: "controller is not running",
+		},
+		{
+			name: "check fails",
+			ctrl: &controller.Controller{},
+			err:  fmt.Errorf("not mounted yet: secret/default/app"),
+			code: http.StatusServiceUnavailable,
+			body: "not mounted yet: secret/default/app",
+		},
+		{
+			name: "check succeeds",
+			ctrl: &controller.Controller{},
+			code: http.StatusOK,
+			body: "ok",
+		},
+	}
+	defer setCurrentController(nil)
+	for _, c := range cases {
+		setCurrentController(c.ctrl)
+		var checked *controller.Controller
+		handler := probe(func(ctrl *controller.Controller) error {
+			checked = ctrl
+			return c.err
+		})
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/readyz", nil))
+		if w.Code != c.code {
+			t.Errorf("%s: expected status %d, found %d", c.name, c.code, w.Code)
+		}
+		if body := strings.TrimSpace(w.Body.String()); body != c.body {
+			t.Errorf("%s: expected body %q, found %q", c.name, c.body, body)
+		}
+		if checked != c.ctrl {
+			t.Errorf("%s: expected the current controller to be checked", c.name)
+		}
+	}
+}
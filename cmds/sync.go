@@ -0,0 +1,93 @@
+package cmds
+
+import (
+	"os"
+	"time"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/kloader/controller"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of `sync --once`
+const (
+	exitFailed       = 1
+	exitNotFound     = 2
+	exitForbidden    = 3
+	exitWriteFailed  = 4
+	exitReloadFailed = 5
+	exitNotComplete  = 6
+	exitInvalid      = 7
+	exitMissingData  = 8
+	exitRenderFailed = 9
+)
+
+func NewSyncCmd() *cobra.Command {
+	var (
+		once        bool
+		waitTimeout = time.Minute
+	)
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Sync the ConfigMaps/Secrets into their mount locations",
+		Long: `Sync the ConfigMaps/Secrets into their mount locations. With --once, kloader waits for the sources
+to exist, mounts them, runs the boot-cmd, signal-process and webhook if any file changed and exits. This is meant
+for init containers. Failures exit with 2 if a source was not found in time, 3 if access was forbidden, 4 if
+the files could not be written, 5 if the boot-cmd, signal or webhook failed, 6 if a source still missed
+required keys, annotations or labels, 7 if the files of a source failed validation, 8 if keys listed in the
+items of a source do not exist, 9 if the data of a source could not be rendered into files and 1 otherwise.
+
+Without --once, kloader keeps syncing like the run command.`,
+		DisableAutoGenTag: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := loadConfiguration(cmd)
+			if err != nil {
+				log.Fatalln("Invalid configuration, Cause", err)
+			}
+			if !once {
+				runAndHold(cmd, cfg)
+			}
+
+			ctrl, err := newController(getRestConfig(), cfg)
+			if err != nil {
+				log.Fatalln("Failed to create controller, Cause", err)
+			}
+			if err := ctrl.SyncOnce(waitTimeout); err != nil {
+				log.Errorln("Failed to sync, Cause", err)
+				log.Flush()
+				os.Exit(syncExitCode(err))
+			}
+		},
+	}
+	addFlags(cmd)
+	cmd.Flags().BoolVar(&once, "once", once, "Sync once and exit")
+	cmd.Flags().DurationVar(&waitTimeout, "wait-timeout", waitTimeout, "With --once, how long to wait for the ConfigMaps/Secrets to be created and meet the requirements. Zero waits forever")
+	return cmd
+}
+
+func syncExitCode(err error) int {
+	syncErr, ok := err.(*controller.SyncError)
+	if !ok {
+		return exitFailed
+	}
+	switch syncErr.Reason {
+	case controller.SyncNotFound:
+		return exitNotFound
+	case controller.SyncForbidden:
+		return exitForbidden
+	case controller.SyncWriteFailed:
+		return exitWriteFailed
+	case controller.SyncReloadFailed:
+		return exitReloadFailed
+	case controller.SyncRequirementsNotMet:
+		return exitNotComplete
+	case controller.SyncValidationFailed:
+		return exitInvalid
+	case controller.SyncMissingData:
+		return exitMissingData
+	case controller.SyncRenderFailed:
+		return exitRenderFailed
+	default:
+		return exitFailed
+	}
+}
@@ -1,15 +1,68 @@
 package cmds
 
 import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/appscode/go/log"
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+	"github.com/appscode/kloader/controller"
 	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 )
 
 var (
-	configMap, secret, mountDir, bashFile string
-	masterURL, kubeconfigPath             string
-	resyncPeriod                          time.Duration = 5 * time.Minute
+	configFile                string
+	configMaps, secrets       []string
+	configMapSelectors        []string
+	secretSelectors           []string
+	mountDir, bashFile        string
+	onDelete, onDeleteCmd     string
+	signalProcess, signalName string
+	webhookURL, webhookMethod string
+	webhookHeaders            []string
+	webhookBody, webhookCA    string
+	webhookInsecure           bool
+	webhookStatusCodes        []int
+	webhookTimeout            time.Duration = 10 * time.Second
+	defaultMode               string
+	keyModes                  []string
+	items, include, exclude   []string
+	requireKeys               []string
+	renderTemplates           bool
+	templateSuffix            string
+	templateNamespaces        []string
+	templateEnv               bool
+	downwardAPIDir            string
+	outputFormat, outputFile  string
+	keyPrefix, keyTransform   string
+	requireAnnotations        []string
+	requireLabels             []string
+	validateJSON              []string
+	validateYAML              []string
+	validateCmd               string
+	validateTimeout           time.Duration = time.Minute
+	uid, gid                  int64         = -1, -1
+	masterURL, kubeconfigPath string
+	metricsAddr               string
+	probeAddr                 string
+	recordEvents              bool          = true
+	resyncPeriod              time.Duration = 5 * time.Minute
+	hookTimeout               time.Duration = time.Minute
+	rollbackOnFailure         bool
+	rerunAfterRollback        bool
+	debounceQuietPeriod       time.Duration
+	debounceMaxWait           time.Duration
+	writeBack                 bool
+	writeBackDelay            time.Duration = time.Second
 
 	// ref: https://github.com/kubernetes/ingress-nginx/blob/e4d53786e771cc6bdd55f180674b79f5b692e552/pkg/ingress/controller/launch.go#L252-L259
 	// High enough QPS to fit all expected use cases. QPS=0 is not set here, because client code is overriding it.
@@ -19,14 +72,460 @@ var (
 )
 
 func addFlags(cmd *cobra.Command) {
-	cmd.Flags().StringVarP(&configMap, "configmap", "c", "", "Configmap name that needs to be mount")
-	cmd.Flags().StringVarP(&secret, "secret", "s", "", "Secret name that needs to be mount")
-	cmd.Flags().StringVarP(&mountDir, "mount-location", "m", "", "Volume location where the file will be mounted")
+	cmd.Flags().StringVar(&configFile, "config", configFile, "Path to a LoaderConfiguration file. Flags that are set explicitly override the values in this file")
+	cmd.Flags().StringArrayVarP(&configMaps, "configmap", "c", nil, "Configmap that needs to be mount, as name[.namespace][=mount-location]. Can be repeated")
+	cmd.Flags().StringArrayVarP(&secrets, "secret", "s", nil, "Secret that needs to be mount, as name[.namespace][=mount-location]. Can be repeated")
+	cmd.Flags().StringArrayVar(&configMapSelectors, "selector", nil, "Label selector of ConfigMaps in the namespace of the pod, like app=gateway. Every matching ConfigMap is mounted into <mount-location>/<name>. Can be repeated")
+	cmd.Flags().StringArrayVar(&secretSelectors, "secret-selector", nil, "Label selector of Secrets in the namespace of the pod. Every matching Secret is mounted into <mount-location>/<name>. Can be repeated")
+	cmd.Flags().StringVarP(&mountDir, "mount-location", "m", "", "Volume location where the file will be mounted, for a ConfigMap/Secret without its own mount location")
 	cmd.Flags().StringVarP(&bashFile, "boot-cmd", "b", "", "Bash script that will be run on every change of the file")
+	cmd.Flags().DurationVar(&hookTimeout, "boot-cmd-timeout", hookTimeout, "Maximum time the boot-cmd and on-delete-cmd may run. Zero means no limit")
+	cmd.Flags().BoolVar(&rollbackOnFailure, "rollback-on-failure", rollbackOnFailure, "Restore the previously mounted files if the boot-cmd fails, instead of retrying it. The rejected ConfigMap/Secret is not mounted again until it changes")
+	cmd.Flags().BoolVar(&rerunAfterRollback, "rerun-after-rollback", rerunAfterRollback, "Run the boot-cmd again after the files were restored by --rollback-on-failure")
+	cmd.Flags().StringVar(&signalProcess, "signal-process", "", "Process to signal after every change, instead of or after the boot-cmd. Either a process name, pidfile:<path> or cgroup:<path>. Requires a shared process namespace in the pod")
+	cmd.Flags().StringVar(&signalName, "signal", "SIGHUP", "Signal sent to the signal-process: SIGHUP, SIGINT, SIGQUIT, SIGUSR1, SIGUSR2, SIGTERM or SIGWINCH")
+	cmd.Flags().StringVar(&webhookURL, "webhook-url", "", "URL called after every change, after the boot-cmd and signal-process")
+	cmd.Flags().StringVar(&webhookMethod, "webhook-method", "POST", "HTTP method of the webhook")
+	cmd.Flags().StringArrayVar(&webhookHeaders, "webhook-header", nil, "Header sent to the webhook, as name=value. Can be repeated")
+	cmd.Flags().StringVar(&webhookBody, "webhook-body", "", "Go template of the webhook request body, executed with the changed sources")
+	cmd.Flags().StringVar(&webhookCA, "webhook-ca-file", "", "PEM encoded CA certificates used to verify the webhook server")
+	cmd.Flags().BoolVar(&webhookInsecure, "webhook-insecure-skip-tls-verify", false, "Skip verifying the certificate of the webhook server")
+	cmd.Flags().IntSliceVar(&webhookStatusCodes, "webhook-status-code", nil, "Status code that marks a successful webhook call (default any 2xx). Can be repeated")
+	cmd.Flags().DurationVar(&webhookTimeout, "webhook-timeout", webhookTimeout, "Timeout of a single webhook call")
+	cmd.Flags().StringVar(&defaultMode, "default-mode", defaultMode, "Octal mode of the mounted files (default 0777 for a ConfigMap, 0400 for a Secret)")
+	cmd.Flags().StringArrayVar(&keyModes, "key-mode", nil, "Octal mode of the file for a single key, as key=mode. Can be repeated")
+	cmd.Flags().Int64Var(&uid, "uid", uid, "If non-negative, owner of the mounted files")
+	cmd.Flags().Int64Var(&gid, "gid", gid, "If non-negative, group of the mounted files")
+	cmd.Flags().StringArrayVar(&items, "item", nil, "Key to mount and the relative path of its file, as key=path. If set, only the listed keys are mounted. Can be repeated")
+	cmd.Flags().StringArrayVar(&include, "include", nil, "Glob pattern, or regular expression if prefixed with re:, of the keys to mount. Can be repeated")
+	cmd.Flags().StringArrayVar(&exclude, "exclude", nil, "Glob pattern, or regular expression if prefixed with re:, of the keys not to mount. Can be repeated")
+	cmd.Flags().BoolVar(&renderTemplates, "template", renderTemplates, "Render the keys ending with the template-suffix as Go templates, and mount them without the suffix")
+	cmd.Flags().StringVar(&templateSuffix, "template-suffix", ".tmpl", "Suffix of the keys rendered with --template")
+	cmd.Flags().StringArrayVar(&templateNamespaces, "template-namespace", nil, "Namespace that the configmap and secret template functions may read from, besides the namespace of the source. Can be repeated")
+	cmd.Flags().BoolVar(&templateEnv, "template-env", templateEnv, "Enable the env and expandenv template functions, which expose the environment of kloader")
+	cmd.Flags().StringVar(&downwardAPIDir, "downward-api-dir", "", "DownwardAPI volume with the labels and annotations files of the pod, used by templates")
+	cmd.Flags().StringVar(&outputFormat, "output-format", "", "Write the keys into a single file in this format: dotenv, json, yaml, properties or toml")
+	cmd.Flags().StringVar(&outputFile, "output-file", "", "Path of the --output-format file, relative to the mount location (default .env, config.json, config.yaml, application.properties or config.toml)")
+	cmd.Flags().StringVar(&keyPrefix, "key-prefix", "", "Prefix of the keys in the --output-format file")
+	cmd.Flags().StringVar(&keyTransform, "key-transform", "", "Transformation of the keys in the --output-format file: upper, lower or env")
+	cmd.Flags().StringSliceVar(&requireKeys, "require-keys", nil, "Keys that must exist in the ConfigMap/Secret before anything is mounted. Until then, kloader keeps waiting")
+	cmd.Flags().StringArrayVar(&requireAnnotations, "require-annotation", nil, "Annotation that must be set on the ConfigMap/Secret before anything is mounted, as name=value. Can be repeated")
+	cmd.Flags().StringArrayVar(&requireLabels, "require-label", nil, "Label that must be set on the ConfigMap/Secret before anything is mounted, as name=value. Can be repeated")
+	cmd.Flags().StringArrayVar(&validateJSON, "validate-json", nil, "Glob pattern, or regular expression if prefixed with re:, of the mounted files that must be valid JSON. Can be repeated")
+	cmd.Flags().StringArrayVar(&validateYAML, "validate-yaml", nil, "Glob pattern, or regular expression if prefixed with re:, of the mounted files that must be valid YAML. Can be repeated")
+	cmd.Flags().StringVar(&validateCmd, "validate-cmd", "", "Bash script run in a staging directory with the new files, $KLOADER_STAGING_DIR, before they are mounted. The files are not mounted if it exits non-zero")
+	cmd.Flags().DurationVar(&validateTimeout, "validate-cmd-timeout", validateTimeout, "Maximum time the validate-cmd may run. Zero means no limit")
+	cmd.Flags().BoolVar(&writeBack, "write-back", writeBack, "Update the ConfigMap/Secret when its mounted files are changed locally. An update is rejected if the ConfigMap/Secret was changed in the cluster since it was mounted")
+	cmd.Flags().DurationVar(&writeBackDelay, "write-back-delay", writeBackDelay, "How long no mounted file may change before the files are written back by --write-back")
+	cmd.Flags().StringVar(&onDelete, "on-delete", string(v1alpha1.DeletePolicyKeep), "What to do when a ConfigMap/Secret is deleted: keep the mounted files, clear them or run the on-delete-cmd hook")
+	cmd.Flags().StringVar(&onDeleteCmd, "on-delete-cmd", "", "Bash script that will be run when a ConfigMap/Secret is deleted, if --on-delete=hook")
 
 	cmd.Flags().StringVar(&masterURL, "master", masterURL, "The address of the Kubernetes API server (overrides any value in kubeconfig)")
 	cmd.Flags().StringVar(&kubeconfigPath, "kubeconfig", kubeconfigPath, "Path to kubeconfig file with authorization information (the master location is set by the master flag).")
 	cmd.Flags().Float32Var(&qps, "qps", qps, "The maximum QPS to the master from this client")
 	cmd.Flags().IntVar(&burst, "burst", burst, "The maximum burst for throttle")
+	cmd.Flags().StringVar(&metricsAddr, "metrics-addr", metricsAddr, "Address to serve Prometheus metrics on, like :8080. Nothing is served if empty")
+	cmd.Flags().StringVar(&probeAddr, "probe-addr", probeAddr, "Address to serve the /healthz and /readyz probes on, like :8081. Nothing is served if empty")
+	cmd.Flags().BoolVar(&recordEvents, "record-events", recordEvents, "Create Events on the ConfigMaps/Secrets, and on the pod named by the POD_NAME and POD_NAMESPACE environment variables")
+	cmd.Flags().DurationVar(&debounceQuietPeriod, "debounce-quiet-period", debounceQuietPeriod, "Mount a ConfigMap/Secret only after no update arrived for this long, so a burst of updates results in a single mount and reload")
+	cmd.Flags().DurationVar(&debounceMaxWait, "debounce-max-wait", debounceMaxWait, "Maximum time a continuous burst of updates may delay a mount. Zero means no limit")
 	cmd.Flags().DurationVar(&resyncPeriod, "resync-period", resyncPeriod, "If non-zero, will re-list this often. Otherwise, re-list will be delayed aslong as possible (until the upstream source closes the watch or times out.")
 }
+
+// loadConfiguration reads the --config file, if any, and applies the flags on
+// top of it. Without a config file, the configuration is built from flags alone.
+func loadConfiguration(cmd *cobra.Command) (*v1alpha1.LoaderConfiguration, error) {
+	var data []byte
+	if configFile != "" {
+		var err error
+		if data, err = ioutil.ReadFile(configFile); err != nil {
+			return nil, err
+		}
+	}
+	return parseConfiguration(cmd, data)
+}
+
+func parseConfiguration(cmd *cobra.Command, data []byte) (*v1alpha1.LoaderConfiguration, error) {
+	cfg := &v1alpha1.LoaderConfiguration{}
+	if configFile != "" {
+		var err error
+		if cfg, err = v1alpha1.Decode(data); err != nil {
+			return nil, err
+		}
+	} else {
+		cfg.APIVersion = v1alpha1.SchemeGroupVersion.String()
+		cfg.Kind = v1alpha1.ResourceKindLoaderConfiguration
+	}
+
+	// flags that were not set explicitly only fill in values missing in the file
+	override := func(name string) bool {
+		return configFile == "" || cmd.Flags().Changed(name)
+	}
+	if override("configmap") || override("secret") || override("selector") || override("secret-selector") {
+		cfg.Sources = nil
+		for _, configMap := range configMaps {
+			ref, dir := splitSource(configMap)
+			cfg.Sources = append(cfg.Sources, v1alpha1.Source{ConfigMap: ref, MountPath: dir})
+		}
+		for _, secret := range secrets {
+			ref, dir := splitSource(secret)
+			cfg.Sources = append(cfg.Sources, v1alpha1.Source{Secret: ref, MountPath: dir})
+		}
+		for _, selector := range configMapSelectors {
+			cfg.Sources = append(cfg.Sources, v1alpha1.Source{ConfigMap: &v1alpha1.ObjectReference{Selector: selector}, MountPath: mountDir})
+		}
+		for _, selector := range secretSelectors {
+			cfg.Sources = append(cfg.Sources, v1alpha1.Source{Secret: &v1alpha1.ObjectReference{Selector: selector}, MountPath: mountDir})
+		}
+	}
+	for i := range cfg.Sources {
+		if err := applyProjectionFlags(&cfg.Sources[i], override); err != nil {
+			return nil, err
+		}
+		if err := applyRequirementFlags(&cfg.Sources[i], override); err != nil {
+			return nil, err
+		}
+		applyValidationFlags(&cfg.Sources[i], override)
+		applyWriteBackFlags(&cfg.Sources[i], override)
+	}
+	if cfg.Hook == nil {
+		cfg.Hook = &v1alpha1.Hook{}
+	}
+	if override("boot-cmd") {
+		cfg.Hook.Command = bashFile
+	}
+	if cfg.Hook.Timeout == nil || override("boot-cmd-timeout") {
+		cfg.Hook.Timeout = &metav1.Duration{Duration: hookTimeout}
+	}
+	if override("rollback-on-failure") {
+		cfg.Hook.RollbackOnFailure = rollbackOnFailure
+	}
+	if override("rerun-after-rollback") {
+		cfg.Hook.RerunAfterRollback = rerunAfterRollback
+	}
+	if signalProcess != "" && override("signal-process") {
+		cfg.SignalProcess = &v1alpha1.SignalProcess{}
+		switch {
+		case strings.HasPrefix(signalProcess, "pidfile:"):
+			cfg.SignalProcess.PIDFile = strings.TrimPrefix(signalProcess, "pidfile:")
+		case strings.HasPrefix(signalProcess, "cgroup:"):
+			cfg.SignalProcess.Cgroup = strings.TrimPrefix(signalProcess, "cgroup:")
+		default:
+			cfg.SignalProcess.Name = signalProcess
+		}
+	}
+	if cfg.SignalProcess != nil && (cfg.SignalProcess.Signal == "" || override("signal")) {
+		cfg.SignalProcess.Signal = signalName
+	}
+	if err := applyWebhookFlags(cfg, override); err != nil {
+		return nil, err
+	}
+	if cfg.OnDelete == nil {
+		cfg.OnDelete = &v1alpha1.OnDelete{Policy: v1alpha1.DeletePolicy(onDelete), Command: onDeleteCmd}
+	}
+	if override("on-delete") {
+		cfg.OnDelete.Policy = v1alpha1.DeletePolicy(onDelete)
+	}
+	if override("on-delete-cmd") {
+		cfg.OnDelete.Command = onDeleteCmd
+	}
+	if cfg.ResyncPeriod == nil || override("resync-period") {
+		cfg.ResyncPeriod = &metav1.Duration{Duration: resyncPeriod}
+	}
+	if cfg.Debounce == nil {
+		cfg.Debounce = &v1alpha1.Debounce{}
+	}
+	if cfg.Debounce.QuietPeriod == nil || override("debounce-quiet-period") {
+		cfg.Debounce.QuietPeriod = &metav1.Duration{Duration: debounceQuietPeriod}
+	}
+	if cfg.Debounce.MaxWait == nil || override("debounce-max-wait") {
+		cfg.Debounce.MaxWait = &metav1.Duration{Duration: debounceMaxWait}
+	}
+	if cfg.RecordEvents == nil || override("record-events") {
+		cfg.RecordEvents = &recordEvents
+	}
+	if metricsAddr != "" && override("metrics-addr") {
+		cfg.MetricsAddress = metricsAddr
+	}
+	if override("probe-addr") {
+		cfg.ProbeAddress = probeAddr
+	}
+
+	if err := cfg.IsValid(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyWebhookFlags sets the webhook flags on cfg. The webhook is only
+// configured if a URL is set by either the file or --webhook-url.
+func applyWebhookFlags(cfg *v1alpha1.LoaderConfiguration, override func(name string) bool) error {
+	if webhookURL != "" && override("webhook-url") {
+		if cfg.Webhook == nil {
+			cfg.Webhook = &v1alpha1.Webhook{}
+		}
+		cfg.Webhook.URL = webhookURL
+	}
+	w := cfg.Webhook
+	if w == nil {
+		return nil
+	}
+	if w.Method == "" || override("webhook-method") {
+		w.Method = webhookMethod
+	}
+	if len(webhookHeaders) > 0 && override("webhook-header") {
+		headers, err := parseKeyValues("webhook-header", webhookHeaders)
+		if err != nil {
+			return err
+		}
+		w.Headers = headers
+	}
+	if webhookBody != "" && override("webhook-body") {
+		w.Body = webhookBody
+	}
+	if webhookCA != "" && override("webhook-ca-file") {
+		w.CAFile = webhookCA
+	}
+	if override("webhook-insecure-skip-tls-verify") {
+		w.InsecureSkipTLSVerify = webhookInsecure
+	}
+	if len(webhookStatusCodes) > 0 && override("webhook-status-code") {
+		w.ExpectedStatusCodes = webhookStatusCodes
+	}
+	if w.Timeout == nil || override("webhook-timeout") {
+		w.Timeout = &metav1.Duration{Duration: webhookTimeout}
+	}
+	return nil
+}
+
+// applyProjectionFlags sets the flags that control how keys are projected on src.
+func applyProjectionFlags(src *v1alpha1.Source, override func(name string) bool) error {
+	if defaultMode != "" && override("default-mode") {
+		mode, err := parseMode(defaultMode)
+		if err != nil {
+			return err
+		}
+		src.DefaultMode = &mode
+	}
+	if len(keyModes) > 0 && override("key-mode") {
+		src.Modes = make(map[string]int32)
+		for _, km := range keyModes {
+			parts := strings.SplitN(km, "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("invalid key-mode %q, expected key=mode", km)
+			}
+			mode, err := parseMode(parts[1])
+			if err != nil {
+				return err
+			}
+			src.Modes[parts[0]] = mode
+		}
+	}
+	if len(items) > 0 && override("item") {
+		src.Items = nil
+		for _, item := range items {
+			parts := strings.SplitN(item, "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("invalid item %q, expected key=path", item)
+			}
+			src.Items = append(src.Items, v1alpha1.KeyToPath{Key: parts[0], Path: parts[1]})
+		}
+	}
+	if len(include) > 0 && override("include") {
+		src.Include = include
+	}
+	if len(exclude) > 0 && override("exclude") {
+		src.Exclude = exclude
+	}
+	if renderTemplates && override("template") {
+		src.Template = &v1alpha1.Template{}
+	}
+	if src.Template != nil {
+		if src.Template.Suffix == "" || override("template-suffix") {
+			src.Template.Suffix = templateSuffix
+		}
+		if downwardAPIDir != "" && override("downward-api-dir") {
+			src.Template.DownwardAPIDir = downwardAPIDir
+		}
+		if len(templateNamespaces) > 0 && override("template-namespace") {
+			src.Template.Namespaces = templateNamespaces
+		}
+		if templateEnv && override("template-env") {
+			src.Template.Env = true
+		}
+	}
+	if outputFormat != "" && override("output-format") {
+		if src.Output == nil {
+			src.Output = &v1alpha1.Output{}
+		}
+		src.Output.Format = v1alpha1.OutputFormat(outputFormat)
+	}
+	if src.Output != nil {
+		if outputFile != "" && override("output-file") {
+			src.Output.File = outputFile
+		}
+		if keyPrefix != "" && override("key-prefix") {
+			src.Output.KeyPrefix = keyPrefix
+		}
+		if keyTransform != "" && override("key-transform") {
+			src.Output.KeyTransform = v1alpha1.KeyTransform(keyTransform)
+		}
+	}
+	if uid >= 0 && override("uid") {
+		src.UID = &uid
+	}
+	if gid >= 0 && override("gid") {
+		src.GID = &gid
+	}
+	return nil
+}
+
+// applyRequirementFlags sets the flags that hold back mounting src until it is complete.
+func applyRequirementFlags(src *v1alpha1.Source, override func(name string) bool) error {
+	require := func() *v1alpha1.Requirements {
+		if src.Require == nil {
+			src.Require = &v1alpha1.Requirements{}
+		}
+		return src.Require
+	}
+	if len(requireKeys) > 0 && override("require-keys") {
+		require().Keys = requireKeys
+	}
+	if len(requireAnnotations) > 0 && override("require-annotation") {
+		annotations, err := parseKeyValues("require-annotation", requireAnnotations)
+		if err != nil {
+			return err
+		}
+		require().Annotations = annotations
+	}
+	if len(requireLabels) > 0 && override("require-label") {
+		labels, err := parseKeyValues("require-label", requireLabels)
+		if err != nil {
+			return err
+		}
+		require().Labels = labels
+	}
+	return nil
+}
+
+// applyWriteBackFlags sets the flags that update src from its mounted files.
+func applyWriteBackFlags(src *v1alpha1.Source, override func(name string) bool) {
+	if writeBack && override("write-back") {
+		src.WriteBack = &v1alpha1.WriteBack{}
+	}
+	if src.WriteBack != nil && (src.WriteBack.Delay == nil || override("write-back-delay")) {
+		src.WriteBack.Delay = &metav1.Duration{Duration: writeBackDelay}
+	}
+}
+
+// applyValidationFlags sets the flags that check the files of src before they are mounted.
+func applyValidationFlags(src *v1alpha1.Source, override func(name string) bool) {
+	validate := func() *v1alpha1.Validation {
+		if src.Validate == nil {
+			src.Validate = &v1alpha1.Validation{}
+		}
+		return src.Validate
+	}
+	if len(validateJSON) > 0 && override("validate-json") {
+		validate().JSON = validateJSON
+	}
+	if len(validateYAML) > 0 && override("validate-yaml") {
+		validate().YAML = validateYAML
+	}
+	if validateCmd != "" && override("validate-cmd") {
+		validate().Command = validateCmd
+	}
+	if src.Validate != nil && (src.Validate.Timeout == nil || override("validate-cmd-timeout")) {
+		src.Validate.Timeout = &metav1.Duration{Duration: validateTimeout}
+	}
+}
+
+func parseKeyValues(flag string, values []string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, kv := range values {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid %s %q, expected name=value", flag, kv)
+		}
+		m[parts[0]] = parts[1]
+	}
+	return m, nil
+}
+
+func parseMode(s string) (int32, error) {
+	mode, err := strconv.ParseInt(s, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mode %q, cause %v", s, err)
+	}
+	return int32(mode), nil
+}
+
+// splitSource splits name[.namespace][=mount-location] into the source
+// reference and its mount location.
+func splitSource(source string) (*v1alpha1.ObjectReference, string) {
+	parts := strings.SplitN(source, "=", 2)
+	dir := mountDir
+	if len(parts) == 2 {
+		dir = parts[1]
+	}
+
+	nameParts := strings.SplitN(strings.TrimSpace(parts[0]), ".", 2)
+	ref := &v1alpha1.ObjectReference{Name: nameParts[0]}
+	if len(nameParts) == 2 {
+		ref.Namespace = nameParts[1]
+	}
+	return ref, dir
+}
+
+// events holds the recorder shared by every controller, so that reloading the
+// config file does not start another event broadcaster.
+var events struct {
+	sync.Once
+	recorder record.EventRecorder
+}
+
+func eventRecorder(config *rest.Config) record.EventRecorder {
+	events.Do(func() {
+		events.recorder = controller.NewEventRecorder(kubernetes.NewForConfigOrDie(config))
+	})
+	return events.recorder
+}
+
+// newController creates a controller for the sources of cfg. It fails if a
+// source cannot be added, like an Endpoints template that does not parse.
+func newController(config *rest.Config, cfg *v1alpha1.LoaderConfiguration) (*controller.Controller, error) {
+	ctrlConfig := controller.Config{
+		Cmd:                 cfg.Hook.Command,
+		HookTimeout:         cfg.Hook.Timeout.Duration,
+		RollbackOnFailure:   cfg.Hook.RollbackOnFailure,
+		RerunAfterRollback:  cfg.Hook.RerunAfterRollback,
+		SignalProcess:       cfg.SignalProcess,
+		Webhook:             cfg.Webhook,
+		ResyncPeriod:        cfg.ResyncPeriod.Duration,
+		DebounceQuietPeriod: cfg.Debounce.QuietPeriod.Duration,
+		DebounceMaxWait:     cfg.Debounce.MaxWait.Duration,
+		OnDelete:            cfg.OnDelete.Policy,
+		OnDeleteCmd:         cfg.OnDelete.Command,
+	}
+	if *cfg.RecordEvents {
+		ctrlConfig.EventRecorder = eventRecorder(config)
+	}
+
+	ctrl := controller.New(config, ctrlConfig)
+	for _, src := range cfg.Sources {
+		if err := ctrl.AddSource(src); err != nil {
+			return nil, fmt.Errorf("failed to add source, cause %v", err)
+		}
+	}
+	return ctrl, nil
+}
+
+func getRestConfig() *rest.Config {
+	config, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfigPath)
+	if err != nil {
+		log.Fatalln("Failed to create KubeConfig")
+	}
+	config.Burst = burst
+	config.QPS = qps
+	return config
+}
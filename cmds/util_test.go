@@ -0,0 +1,225 @@
+package cmds
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// newTestCommand returns a command with the flags of kloader set to args,
+// and a function that restores the flags to their defaults. The defaults of
+// most flags are the values of their variables when they are added, so they
+// must be restored before the next command is created.
+func newTestCommand(t *testing.T, args ...string) (*cobra.Command, func()) {
+	cmd := &cobra.Command{Use: "test"}
+	addFlags(cmd)
+	reset := func() {
+		cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+			// slice flags are reset by addFlags
+			if flag.Changed && !strings.HasSuffix(flag.Value.Type(), "Slice") && !strings.HasSuffix(flag.Value.Type(), "Array") {
+				flag.Value.Set(flag.DefValue)
+			}
+		})
+	}
+	if err := cmd.Flags().Parse(args); err != nil {
+		reset()
+		t.Fatal(err)
+	}
+	return cmd, reset
+}
+
+const testConfigFile = `
+apiVersion: kloader.appscode.com/v1alpha1
+kind: LoaderConfiguration
+sources:
+- configMap:
+    name: file
+  mountPath: /etc/file
+  uid: 10
+hook:
+  command: file-cmd
+  timeout: 30s
+onDelete:
+  policy: clear
+resyncPeriod: 1m
+probeAddress: ":9000"
+`
+
+func TestParseConfiguration(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		file string
+
+		sources     []string
+		uid         int64
+		hookCmd     string
+		hookTimeout time.Duration
+		onDelete    v1alpha1.DeletePolicy
+		resync      time.Duration
+		probeAddr   string
+		err         string
+	}{
+		{
+			name:        "flags without a file",
+			args:        []string{"--configmap", "app=/etc/app", "--boot-cmd", "flag-cmd", "--uid", "20"},
+			sources:     []string{"app=/etc/app"},
+			uid:         20,
+			hookCmd:     "flag-cmd",
+			hookTimeout: time.Minute,
+			onDelete:    v1alpha1.DeletePolicyKeep,
+			resync:      5 * time.Minute,
+		},
+		{
+			name:        "file without flags",
+			args:        []string{"--config", "kloader.yaml"},
+			file:        testConfigFile,
+			sources:     []string{"file=/etc/file"},
+			uid:         10,
+			hookCmd:     "file-cmd",
+			hookTimeout: 30 * time.Second,
+			onDelete:    v1alpha1.DeletePolicyClear,
+			resync:      time.Minute,
+			probeAddr:   ":9000",
+		},
+		{
+			name: "flags override the file",
+			args: []string{"--config", "kloader.yaml", "--boot-cmd", "flag-cmd", "--boot-cmd-timeout", "2m",
+				"--on-delete", "keep", "--resync-period", "10m", "--probe-addr", ":9100", "--uid", "20"},
+			file:        testConfigFile,
+			sources:     []string{"file=/etc/file"},
+			uid:         20,
+			hookCmd:     "flag-cmd",
+			hookTimeout: 2 * time.Minute,
+			onDelete:    v1alpha1.DeletePolicyKeep,
+			resync:      10 * time.Minute,
+			probeAddr:   ":9100",
+		},
+		{
+			name:        "source flags replace the sources of the file",
+			args:        []string{"--config", "kloader.yaml", "--secret", "tls.kube-system=/etc/tls"},
+			file:        testConfigFile,
+			sources:     []string{"tls=/etc/tls"},
+			uid:         -1,
+			hookCmd:     "file-cmd",
+			hookTimeout: 30 * time.Second,
+			onDelete:    v1alpha1.DeletePolicyClear,
+			resync:      time.Minute,
+			probeAddr:   ":9000",
+		},
+		{
+			name: "defaults fill in the fields missing in the file",
+			args: []string{"--config", "kloader.yaml", "--boot-cmd-timeout", "3m"},
+			file: `
+apiVersion: kloader.appscode.com/v1alpha1
+kind: LoaderConfiguration
+sources:
+- configMap:
+    name: file
+  mountPath: /etc/file
+`,
+			sources:     []string{"file=/etc/file"},
+			uid:         -1,
+			hookTimeout: 3 * time.Minute,
+			onDelete:    v1alpha1.DeletePolicyKeep,
+			resync:      5 * time.Minute,
+		},
+		{
+			name: "empty probe address in the file",
+			args: []string{"--config", "kloader.yaml"},
+			file: `
+apiVersion: kloader.appscode.com/v1alpha1
+kind: LoaderConfiguration
+sources:
+- configMap:
+    name: file
+  mountPath: /etc/file
+probeAddress: ""
+`,
+			sources:     []string{"file=/etc/file"},
+			uid:         -1,
+			hookTimeout: time.Minute,
+			onDelete:    v1alpha1.DeletePolicyKeep,
+			resync:      5 * time.Minute,
+		},
+		{
+			name:        "empty flag overrides the probe address of the file",
+			args:        []string{"--config", "kloader.yaml", "--probe-addr="},
+			file:        testConfigFile,
+			sources:     []string{"file=/etc/file"},
+			uid:         10,
+			hookCmd:     "file-cmd",
+			hookTimeout: 30 * time.Second,
+			onDelete:    v1alpha1.DeletePolicyClear,
+			resync:      time.Minute,
+		},
+		{
+			name: "invalid file",
+			args: []string{"--config", "kloader.yaml"},
+			file: `
+apiVersion: kloader.appscode.com/v1alpha1
+kind: LoaderConfiguration
+sources:
+- configMap:
+    name: file
+`,
+			err: "mountPath is required",
+		},
+	}
+	for _, c := range cases {
+		func() {
+			cmd, reset := newTestCommand(t, c.args...)
+			defer reset()
+
+			cfg, err := parseConfiguration(cmd, []byte(c.file))
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Errorf("%s: expected error %q, found %v", c.name, c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", c.name, err)
+				return
+			}
+			var sources []string
+			for _, src := range cfg.Sources {
+				ref := src.ConfigMap
+				if ref == nil {
+					ref = src.Secret
+				}
+				sources = append(sources, ref.Name+"="+src.MountPath)
+				uid := int64(-1)
+				if src.UID != nil {
+					uid = *src.UID
+				}
+				if uid != c.uid {
+					t.Errorf("%s: expected uid %d, found %d", c.name, c.uid, uid)
+				}
+			}
+			if strings.Join(sources, " ") != strings.Join(c.sources, " ") {
+				t.Errorf("%s: expected sources %v, found %v", c.name, c.sources, sources)
+			}
+			if cfg.Hook.Command != c.hookCmd || cfg.Hook.Timeout.Duration != c.hookTimeout {
+				t.Errorf("%s: expected hook %q with timeout %v, found %q with timeout %v", c.name, c.hookCmd, c.hookTimeout, cfg.Hook.Command, cfg.Hook.Timeout.Duration)
+			}
+			if cfg.OnDelete.Policy != c.onDelete {
+				t.Errorf("%s: expected on-delete policy %s, found %s", c.name, c.onDelete, cfg.OnDelete.Policy)
+			}
+			if cfg.ResyncPeriod.Duration != c.resync {
+				t.Errorf("%s: expected resync period %v, found %v", c.name, c.resync, cfg.ResyncPeriod.Duration)
+			}
+			if cfg.ProbeAddress != c.probeAddr {
+				t.Errorf("%s: expected probe address %q, found %q", c.name, c.probeAddr, cfg.ProbeAddress)
+			}
+			// fields that are neither in the file nor set by a flag get their defaults
+			if cfg.Debounce.QuietPeriod == nil || cfg.Debounce.MaxWait == nil || cfg.RecordEvents == nil || !*cfg.RecordEvents {
+				t.Errorf("%s: expected the debounce periods and recordEvents to be defaulted, found %+v and %v", c.name, cfg.Debounce, cfg.RecordEvents)
+			}
+		}()
+	}
+}
@@ -0,0 +1,525 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/appscode/go/log"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// ref: https://github.com/kubernetes/kubernetes/blob/v1.8.0/pkg/volume/util/atomic_writer.go
+
+const (
+	maxFileNameLength = 255
+	maxPathLength     = 4096
+
+	dataDirName    = "..data"
+	newDataDirName = "..data_tmp"
+)
+
+// AtomicWriter handles atomically projecting content for a set of files into
+// a target directory.
+//
+// Note:
+//
+//  1. AtomicWriter reserves the set of pathnames starting with `..`.
+//  2. AtomicWriter offers no concurrency guarantees and must be synchronized
+//     by the caller.
+//
+// The visible files in this volume are symlinks to files in the writer's data
+// directory. Actual files are stored in a hidden timestamped directory which
+// is symlinked to by the data directory. The timestamped directory and data
+// directory symlink are created in the writer's target dir. This scheme
+// allows the files to be atomically updated by changing the target of the
+// data directory symlink.
+//
+// Consumers of the target directory can monitor the ..data symlink using
+// inotify or fanotify to receive events when the content in the volume is
+// updated.
+type AtomicWriter struct {
+	targetDir  string
+	logContext string
+}
+
+type FileProjection struct {
+	Data []byte
+	Mode int32
+	// UID and GID own the file, if set.
+	UID *int64
+	GID *int64
+}
+
+// NewAtomicWriter creates a new AtomicWriter configured to write to the given
+// target directory, or returns an error if the target directory does not exist.
+func NewAtomicWriter(targetDir, logContext string) (*AtomicWriter, error) {
+	_, err := os.Stat(targetDir)
+	if os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return &AtomicWriter{targetDir: targetDir, logContext: logContext}, nil
+}
+
+// Write does an atomic projection of the given payload into the writer's target
+// directory. Input paths must not begin with '..'. It reports whether anything
+// was written to disk.
+//
+// The Write algorithm is:
+//
+//  1. The payload is validated; if the payload is invalid, or the symlink of
+//     a path would replace anything but a regular file in the target
+//     directory, the function returns
+//
+//  2. The current timestamped directory is detected by reading the data
+//     directory symlink; if there is none and the payload is empty, the
+//     function returns
+//
+//  3. The old version of the volume is walked to determine whether any
+//     portion of the payload was deleted and is still present on disk
+//
+//  4. The data in the current timestamped directory is compared to the
+//     projected data to determine if an update is required; if the payload
+//     is already present on disk and there are no deleted files, the function
+//     returns
+//
+//  5. A new timestamped dir is created
+//
+//  6. The payload is written to the new timestamped directory
+//
+//  7. A symlink to the new timestamped directory ..data_tmp is created that will
+//     become the new data directory
+//
+//  8. The new data directory symlink is renamed to the data directory; rename is atomic
+//
+//  9. Symlinks for new user-visible files are created (if needed).
+//
+//     For example, consider the files:
+//     <target-dir>/podName
+//     <target-dir>/user/labels
+//     <target-dir>/k8s/annotations
+//
+//     The user visible files are symbolic links into the internal data directory:
+//     <target-dir>/podName         -> ..data/podName
+//     <target-dir>/usr             -> ..data/usr
+//     <target-dir>/k8s             -> ..data/k8s
+//
+//     The data directory itself is a link to a timestamped directory with
+//     the real data:
+//     <target-dir>/..data          -> ..2016_02_01_15_04_05.12345678/
+//
+//  10. Old paths are removed from the user-visible portion of the target directory
+//
+//  11. The previous timestamped directory is removed, if it exists
+func (w *AtomicWriter) Write(payload map[string]FileProjection) (bool, error) {
+	// (1)
+	cleanPayload, err := validatePayload(payload)
+	if err != nil {
+		log.Errorf("%s: invalid payload: %v\n", w.logContext, err)
+		return false, err
+	}
+	if err := w.checkUserVisiblePaths(cleanPayload); err != nil {
+		log.Errorf("%s: invalid payload: %v\n", w.logContext, err)
+		return false, err
+	}
+
+	// (2)
+	dataDirPath := path.Join(w.targetDir, dataDirName)
+	oldTsDir, err := os.Readlink(dataDirPath)
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("%s: error reading link for data directory: %v\n", w.logContext, err)
+		return false, err
+	}
+	oldTsPath := path.Join(w.targetDir, oldTsDir)
+
+	if len(oldTsDir) == 0 && len(cleanPayload) == 0 {
+		log.Infof("%s: no update required for target directory %v\n", w.logContext, w.targetDir)
+		return false, nil
+	}
+
+	var pathsToRemove sets.String
+	// if there was no old version, there's nothing to remove
+	if len(oldTsDir) != 0 {
+		// (3)
+		pathsToRemove, err = w.pathsToRemove(cleanPayload, oldTsPath)
+		if err != nil {
+			log.Errorf("%s: error determining user-visible files to remove: %v\n", w.logContext, err)
+			return false, err
+		}
+
+		// (4)
+		if should, err := shouldWritePayload(cleanPayload, oldTsPath); err != nil {
+			log.Errorf("%s: error determining whether payload should be written to disk: %v\n", w.logContext, err)
+			return false, err
+		} else if !should && len(pathsToRemove) == 0 {
+			log.Infof("%s: no update required for target directory %v\n", w.logContext, w.targetDir)
+			return false, nil
+		} else {
+			log.Infof("%s: write required for target directory %v\n", w.logContext, w.targetDir)
+		}
+	}
+
+	// (5)
+	tsDir, err := w.newTimestampDir()
+	if err != nil {
+		log.Errorf("%s: error creating new ts data directory: %v\n", w.logContext, err)
+		return false, err
+	}
+	tsDirName := filepath.Base(tsDir)
+
+	// (6)
+	if err = w.writePayloadToDir(cleanPayload, tsDir); err != nil {
+		log.Errorf("%s: error writing payload to ts data directory %s: %v\n", w.logContext, tsDir, err)
+		os.RemoveAll(tsDir)
+		return false, err
+	}
+	log.Infof("%s: performed write of new data to ts data directory: %s\n", w.logContext, tsDir)
+
+	// (7)
+	newDataDirPath := path.Join(w.targetDir, newDataDirName)
+	if err = os.Symlink(tsDirName, newDataDirPath); err != nil {
+		os.RemoveAll(tsDir)
+		log.Errorf("%s: error creating symbolic link for atomic update: %v\n", w.logContext, err)
+		return false, err
+	}
+
+	// (8)
+	if err = os.Rename(newDataDirPath, dataDirPath); err != nil {
+		os.Remove(newDataDirPath)
+		os.RemoveAll(tsDir)
+		log.Errorf("%s: error renaming symbolic link for data directory %s: %v\n", w.logContext, newDataDirPath, err)
+		return false, err
+	}
+
+	// (9)
+	if err = w.createUserVisibleFiles(cleanPayload); err != nil {
+		log.Errorf("%s: error creating visible symlinks in %s: %v\n", w.logContext, w.targetDir, err)
+		return false, err
+	}
+
+	// (10)
+	if err = w.removeUserVisiblePaths(pathsToRemove); err != nil {
+		log.Errorf("%s: error removing old visible symlinks: %v\n", w.logContext, err)
+		return false, err
+	}
+
+	// (11)
+	if len(oldTsDir) > 0 {
+		if err = os.RemoveAll(oldTsPath); err != nil {
+			log.Errorf("%s: error removing old data directory %s: %v\n", w.logContext, oldTsDir, err)
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// validatePayload returns an error if any path in the payload is invalid,
+// otherwise it returns a copy of the payload with the paths cleaned.
+func validatePayload(payload map[string]FileProjection) (map[string]FileProjection, error) {
+	cleanPayload := make(map[string]FileProjection)
+	for k, content := range payload {
+		if err := validatePath(k); err != nil {
+			return nil, err
+		}
+
+		cleanPayload[path.Clean(k)] = content
+	}
+
+	return cleanPayload, nil
+}
+
+// validatePath validates a single path, returning an error if the path is
+// invalid.  paths may not:
+//
+// 1. be absolute
+// 2. contain '..' as an element
+// 3. start with '..'
+// 4. contain filenames larger than 255 characters
+// 5. be longer than 4096 characters
+func validatePath(targetPath string) error {
+	// TODO: somehow unify this with the similar api validation,
+	// validateVolumeSourcePath; the error semantics are just different enough
+	// from this that it was time-prohibitive trying to find the right
+	// refactoring to re-use.
+	if targetPath == "" {
+		return fmt.Errorf("invalid path: must not be empty: %q", targetPath)
+	}
+	if path.IsAbs(targetPath) {
+		return fmt.Errorf("invalid path: must be relative path: %s", targetPath)
+	}
+
+	if len(targetPath) > maxPathLength {
+		return fmt.Errorf("invalid path: must be less than %d characters", maxPathLength)
+	}
+
+	items := strings.Split(targetPath, string(os.PathSeparator))
+	for _, item := range items {
+		if item == ".." {
+			return fmt.Errorf("invalid path: must not contain '..': %s", targetPath)
+		}
+		if len(item) > maxFileNameLength {
+			return fmt.Errorf("invalid path: filenames must be less than %d characters", maxFileNameLength)
+		}
+	}
+	if strings.HasPrefix(items[0], "..") && len(items[0]) > 2 {
+		return fmt.Errorf("invalid path: must not start with '..': %s", targetPath)
+	}
+
+	return nil
+}
+
+// shouldWritePayload returns whether the payload should be written to disk.
+func shouldWritePayload(payload map[string]FileProjection, oldTsDir string) (bool, error) {
+	for userVisiblePath, fileProjection := range payload {
+		shouldWrite, err := shouldWriteFile(path.Join(oldTsDir, userVisiblePath), fileProjection)
+		if err != nil {
+			return false, err
+		}
+
+		if shouldWrite {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// shouldWriteFile returns whether a new version of a file should be written to disk.
+func shouldWriteFile(path string, projection FileProjection) (bool, error) {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	if fi.Mode().Perm() != os.FileMode(projection.Mode).Perm() {
+		return true, nil
+	}
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+		if projection.UID != nil && int64(stat.Uid) != *projection.UID {
+			return true, nil
+		}
+		if projection.GID != nil && int64(stat.Gid) != *projection.GID {
+			return true, nil
+		}
+	}
+
+	contentOnFs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	return !bytes.Equal(projection.Data, contentOnFs), nil
+}
+
+// pathsToRemove walks the user-visible portion of the target directory and
+// determines which paths should be removed (if any) after the payload is
+// written to the target directory.
+func (w *AtomicWriter) pathsToRemove(payload map[string]FileProjection, oldTsDir string) (sets.String, error) {
+	paths := sets.NewString()
+	visitor := func(path string, info os.FileInfo, err error) error {
+		relativePath := strings.TrimPrefix(path, oldTsDir)
+		relativePath = strings.TrimPrefix(relativePath, string(os.PathSeparator))
+		if relativePath == "" {
+			return nil
+		}
+
+		paths.Insert(relativePath)
+		return nil
+	}
+
+	err := filepath.Walk(oldTsDir, visitor)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	log.Infof("%s: current paths:   %+v\n", w.logContext, paths.List())
+
+	newPaths := sets.NewString()
+	for file := range payload {
+		// add all subpaths for the payload to the set of new paths
+		// to avoid attempting to remove non-empty dirs
+		for subPath := file; subPath != ""; {
+			newPaths.Insert(subPath)
+			subPath, _ = filepath.Split(subPath)
+			subPath = strings.TrimSuffix(subPath, string(os.PathSeparator))
+		}
+	}
+	log.Infof("%s: new paths:       %+v\n", w.logContext, newPaths.List())
+
+	result := paths.Difference(newPaths)
+	log.Infof("%s: paths to remove: %+v\n", w.logContext, result)
+
+	return result, nil
+}
+
+// newTimestampDir creates a new timestamp directory
+func (w *AtomicWriter) newTimestampDir() (string, error) {
+	tsDir, err := ioutil.TempDir(w.targetDir, time.Now().UTC().Format("..2006_01_02_15_04_05."))
+	if err != nil {
+		log.Errorf("%s: unable to create new temp directory: %v\n", w.logContext, err)
+		return "", err
+	}
+
+	// 0755 permissions are needed to allow 'group' and 'other' to recurse the
+	// directory tree.  do a chmod here to ensure that permissions are set correctly
+	// regardless of the process' umask.
+	err = os.Chmod(tsDir, 0755)
+	if err != nil {
+		log.Errorf("%s: unable to set mode on new temp directory: %v\n", w.logContext, err)
+		return "", err
+	}
+
+	return tsDir, nil
+}
+
+// writePayloadToDir writes the given payload to the given directory.  The
+// directory must exist.
+func (w *AtomicWriter) writePayloadToDir(payload map[string]FileProjection, dir string) error {
+	for userVisiblePath, fileProjection := range payload {
+		content := fileProjection.Data
+		mode := os.FileMode(fileProjection.Mode)
+		fullPath := path.Join(dir, userVisiblePath)
+		baseDir, _ := filepath.Split(fullPath)
+
+		err := os.MkdirAll(baseDir, os.ModePerm)
+		if err != nil {
+			log.Errorf("%s: unable to create directory %s: %v\n", w.logContext, baseDir, err)
+			return err
+		}
+
+		err = ioutil.WriteFile(fullPath, content, mode)
+		if err != nil {
+			log.Errorf("%s: unable to write file %s with mode %v: %v\n", w.logContext, fullPath, mode, err)
+			return err
+		}
+		// Chmod is needed because ioutil.WriteFile() ends up calling
+		// open(2) to create the file, so the final mode used is "mode &
+		// ~umask". But we want to make sure the specified mode is used
+		// in the file no matter what the umask is.
+		if err := os.Chmod(fullPath, mode); err != nil {
+			log.Errorf("%s: unable to change file %s with mode %v: %v\n", w.logContext, fullPath, mode, err)
+			return err
+		}
+
+		if fileProjection.UID != nil || fileProjection.GID != nil {
+			uid, gid := -1, -1
+			if fileProjection.UID != nil {
+				uid = int(*fileProjection.UID)
+			}
+			if fileProjection.GID != nil {
+				gid = int(*fileProjection.GID)
+			}
+			if err := os.Lchown(fullPath, uid, gid); err != nil {
+				log.Errorf("%s: unable to change owner of file %s to %d:%d: %v\n", w.logContext, fullPath, uid, gid, err)
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// createUserVisibleFiles creates the relative symlinks for all the
+// files configured in the payload. If the directory in a file path does not
+// exist, it is created.
+//
+// Viz:
+// For files: "bar", "foo/bar", "baz/bar", "foo/baz/blah"
+// the following symlinks are created:
+// bar -> ..data/bar
+// foo -> ..data/foo
+// baz -> ..data/baz
+func (w *AtomicWriter) createUserVisibleFiles(payload map[string]FileProjection) error {
+	for userVisiblePath := range payload {
+		slashpos := strings.Index(userVisiblePath, string(os.PathSeparator))
+		if slashpos == -1 {
+			slashpos = len(userVisiblePath)
+		}
+		linkname := userVisiblePath[:slashpos]
+		visibleFile := path.Join(w.targetDir, linkname)
+
+		fi, err := os.Lstat(visibleFile)
+		if err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
+			if err := checkUserVisibleFile(visibleFile, fi); err != nil {
+				return err
+			}
+			// A regular file left behind by an older, non-atomic version of
+			// kloader. Replace it with a symlink into the data dir.
+			if err = os.Remove(visibleFile); err != nil {
+				return err
+			}
+		}
+
+		dataDirFile := path.Join(dataDirName, linkname)
+		if err = os.Symlink(dataDirFile, visibleFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkUserVisiblePaths returns an error if the symlink of a path in the
+// payload would replace anything but a symlink or a regular file, like a
+// directory of the user, before anything is written.
+func (w *AtomicWriter) checkUserVisiblePaths(payload map[string]FileProjection) error {
+	for userVisiblePath := range payload {
+		linkname := strings.SplitN(userVisiblePath, string(os.PathSeparator), 2)[0]
+		visibleFile := path.Join(w.targetDir, linkname)
+		fi, err := os.Lstat(visibleFile)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+		if err := checkUserVisibleFile(visibleFile, fi); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkUserVisibleFile returns an error unless the entry at visibleFile,
+// which is not a symlink, is a regular file that may be replaced.
+func checkUserVisibleFile(visibleFile string, fi os.FileInfo) error {
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file and would be replaced by the symlink of a mounted path", visibleFile)
+	}
+	return nil
+}
+
+// removeUserVisiblePaths removes the set of paths from the user-visible
+// portion of the writer's target directory.
+func (w *AtomicWriter) removeUserVisiblePaths(paths sets.String) error {
+	for p := range paths {
+		// only remove symlinks from the volume root directory (i.e. items that don't contain '/')
+		if strings.Contains(p, "/") {
+			continue
+		}
+		if err := os.Remove(path.Join(w.targetDir, p)); err != nil {
+			log.Errorf("%s: error pruning old user-visible path %s: %v\n", w.logContext, p, err)
+			return err
+		}
+	}
+
+	return nil
+}
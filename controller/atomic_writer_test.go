@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestAtomicWriterRewrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomic-writer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	w, err := NewAtomicWriter(dir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uid, otherUID := int64(os.Getuid()), int64(os.Getuid()+1)
+	cases := []struct {
+		name    string
+		payload map[string]FileProjection
+		written bool
+		root    bool
+	}{
+		{
+			name:    "initial write",
+			payload: map[string]FileProjection{"a": {Data: []byte("a"), Mode: 0644}, "sub/b": {Data: []byte("b"), Mode: 0644}},
+			written: true,
+		},
+		{
+			name:    "unchanged",
+			payload: map[string]FileProjection{"a": {Data: []byte("a"), Mode: 0644}, "sub/b": {Data: []byte("b"), Mode: 0644}},
+		},
+		{
+			name:    "mode changed",
+			payload: map[string]FileProjection{"a": {Data: []byte("a"), Mode: 0400}, "sub/b": {Data: []byte("b"), Mode: 0644}},
+			written: true,
+		},
+		{
+			name:    "owner unchanged",
+			payload: map[string]FileProjection{"a": {Data: []byte("a"), Mode: 0400, UID: &uid}, "sub/b": {Data: []byte("b"), Mode: 0644}},
+		},
+		{
+			name:    "owner changed",
+			payload: map[string]FileProjection{"a": {Data: []byte("a"), Mode: 0400, UID: &otherUID}, "sub/b": {Data: []byte("b"), Mode: 0644}},
+			written: true,
+			root:    true,
+		},
+		{
+			name:    "content changed",
+			payload: map[string]FileProjection{"a": {Data: []byte("A"), Mode: 0400}, "sub/b": {Data: []byte("b"), Mode: 0644}},
+			written: true,
+		},
+		{
+			name:    "file removed",
+			payload: map[string]FileProjection{"a": {Data: []byte("A"), Mode: 0400}},
+			written: true,
+		},
+	}
+	for _, c := range cases {
+		if c.root && os.Geteuid() != 0 {
+			t.Logf("%s: skipped, changing the owner requires root", c.name)
+			continue
+		}
+		written, err := w.Write(c.payload)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if written != c.written {
+			t.Errorf("%s: expected written %v, found %v", c.name, c.written, written)
+		}
+		for p, projection := range c.payload {
+			path := filepath.Join(dir, p)
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+			if string(data) != string(projection.Data) {
+				t.Errorf("%s: expected %s to contain %q, found %q", c.name, p, projection.Data, data)
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+			if fi.Mode().Perm() != os.FileMode(projection.Mode) {
+				t.Errorf("%s: expected %s to have mode %v, found %v", c.name, p, os.FileMode(projection.Mode), fi.Mode().Perm())
+			}
+			if projection.UID != nil && int64(fi.Sys().(*syscall.Stat_t).Uid) != *projection.UID {
+				t.Errorf("%s: expected %s to be owned by %d, found %d", c.name, p, *projection.UID, fi.Sys().(*syscall.Stat_t).Uid)
+			}
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "sub")); !os.IsNotExist(err) {
+		t.Errorf("expected the removed directory sub to be pruned, found %v", err)
+	}
+}
+
+func TestAtomicWriterLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomic-writer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	w, err := NewAtomicWriter(dir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if written, err := w.Write(nil); err != nil || written {
+		t.Errorf("expected an empty first write to do nothing, found written %v: %v", written, err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, dataDirName)); !os.IsNotExist(err) {
+		t.Errorf("expected no %s after an empty first write, found %v", dataDirName, err)
+	}
+
+	// a directory of the user is never replaced by the symlink of a nested path
+	if err := os.MkdirAll(filepath.Join(dir, "conf.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	unrelated := filepath.Join(dir, "conf.d", "unrelated.conf")
+	if err := ioutil.WriteFile(unrelated, []byte("unrelated"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	payload := map[string]FileProjection{
+		"app.conf":       {Data: []byte("new"), Mode: 0644},
+		"conf.d/db.conf": {Data: []byte("db"), Mode: 0644},
+	}
+	if written, err := w.Write(payload); err == nil || written {
+		t.Errorf("expected the directory conf.d to be rejected, found written %v: %v", written, err)
+	}
+	if data, err := ioutil.ReadFile(unrelated); err != nil || string(data) != "unrelated" {
+		t.Errorf("expected conf.d/unrelated.conf to be kept, found %q: %v", data, err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, dataDirName)); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be written for a rejected payload, found %v", err)
+	}
+	if err := os.RemoveAll(filepath.Join(dir, "conf.d")); err != nil {
+		t.Fatal(err)
+	}
+
+	// files of an older, non-atomic kloader are replaced by symlinks
+	if err := ioutil.WriteFile(filepath.Join(dir, "app.conf"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "conf.d"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if written, err := w.Write(payload); err != nil || !written {
+		t.Fatalf("expected the payload to be written, found written %v: %v", written, err)
+	}
+
+	tsDir, err := os.Readlink(filepath.Join(dir, dataDirName))
+	if err != nil {
+		t.Fatalf("expected %s to be a symlink, cause %v", dataDirName, err)
+	}
+	if !strings.HasPrefix(tsDir, "..") || strings.Contains(tsDir, "/") {
+		t.Errorf("expected %s to point to a hidden directory in the target directory, found %s", dataDirName, tsDir)
+	}
+	for _, name := range []string{"app.conf", "conf.d"} {
+		target, err := os.Readlink(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("expected %s to be a symlink, cause %v", name, err)
+		} else if expected := filepath.Join(dataDirName, name); target != expected {
+			t.Errorf("expected %s to point to %s, found %s", name, expected, target)
+		}
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "app.conf")); err != nil || string(data) != "new" {
+		t.Errorf("expected app.conf to contain %q, found %q: %v", "new", data, err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "conf.d", "db.conf")); err != nil || string(data) != "db" {
+		t.Errorf("expected conf.d/db.conf to contain %q, found %q: %v", "db", data, err)
+	}
+
+	// the previous timestamped directory is removed after a swap
+	payload["app.conf"] = FileProjection{Data: []byte("newer"), Mode: 0644}
+	if written, err := w.Write(payload); err != nil || !written {
+		t.Fatalf("expected the payload to be written, found written %v: %v", written, err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, tsDir)); !os.IsNotExist(err) {
+		t.Errorf("expected the old data directory %s to be removed, found %v", tsDir, err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, newDataDirName)); !os.IsNotExist(err) {
+		t.Errorf("expected no %s to be left behind, found %v", newDataDirName, err)
+	}
+}
+
+func TestValidatePath(t *testing.T) {
+	cases := []struct {
+		path  string
+		valid bool
+	}{
+		{"a", true},
+		{"a/b/c", true},
+		{"..a", false},
+		{"a/../b", false},
+		{"/a", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		if err := validatePath(c.path); (err == nil) != c.valid {
+			t.Errorf("%q: expected valid %v, found %v", c.path, c.valid, err)
+		}
+	}
+}
@@ -0,0 +1,628 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	maxRetries = 5
+
+	// reloadQueueKey is queued to run the reloaders after the queued sources are mounted.
+	reloadQueueKey = "reload"
+)
+
+// Controller projects any number of ConfigMaps and Secrets into their mount
+// locations and runs the boot command, signals a process or calls a webhook
+// after a set of changes was mounted.
+type Controller struct {
+	KubeClient clientset.Interface
+	Config
+
+	kubeConfig *rest.Config
+
+	queue     workqueue.RateLimitingInterface
+	debouncer *debouncer
+	recorder  *eventRecorder
+	informers *informerFactory
+	reloaders []reloader
+	// selectors holds the sources with a label selector, by informer key. It
+	// is not modified once the controller runs.
+	selectors map[informerKey]*selectorSource
+
+	// pending holds the changes mounted since the reloaders last succeeded. It
+	// is only accessed from the worker goroutine.
+	pending changeSet
+	// rejected holds the sources that failed validation or were rolled back,
+	// by queue key. It is only accessed from the worker goroutine.
+	rejected map[string]*rejection
+
+	// lock guards mounters, selected, synced, waiting, echoes, dependents
+	// and reloadPending. Mounters of objects matching a selector come and go
+	// while running.
+	lock     sync.RWMutex
+	mounters map[string]*Mounter
+	// selected holds the informer key of the selector of every matched object, by queue key.
+	selected map[string]informerKey
+	synced   sets.String
+	// waiting holds the unmet requirements of sources, by queue key.
+	waiting map[string]string
+	// echoes holds the resourceVersion every source was last written back
+	// at, by queue key, until the informer received it.
+	echoes map[string]string
+	// dependents holds the queue keys of the sources whose templates read an
+	// object, by the informer key of the object.
+	dependents    map[informerKey]sets.String
+	reloadPending bool
+}
+
+type Config struct {
+	// Cmd is run after a set of changes has been mounted.
+	Cmd string
+	// HookTimeout limits how long Cmd and OnDeleteCmd may run. Zero means no limit.
+	HookTimeout time.Duration
+	// RollbackOnFailure restores the previously mounted files if Cmd fails,
+	// and RerunAfterRollback runs Cmd again for them.
+	RollbackOnFailure  bool
+	RerunAfterRollback bool
+	// SignalProcess is signalled after a set of changes has been mounted and Cmd has run.
+	SignalProcess *v1alpha1.SignalProcess
+	// Webhook is called after a set of changes has been mounted and SignalProcess was signalled.
+	Webhook      *v1alpha1.Webhook
+	ResyncPeriod time.Duration
+	// DebounceQuietPeriod delays mounting a source until no event for it
+	// arrived for this long, but no longer than DebounceMaxWait if non-zero.
+	DebounceQuietPeriod time.Duration
+	DebounceMaxWait     time.Duration
+	// OnDelete decides what happens when a source is deleted.
+	OnDelete    v1alpha1.DeletePolicy
+	OnDeleteCmd string
+	// EventRecorder, if set, creates Events on the sources and on the pod
+	// named by the POD_NAME and POD_NAMESPACE environment variables. See
+	// NewEventRecorder.
+	EventRecorder record.EventRecorder
+}
+
+func New(kubeConfig *rest.Config, config Config) *Controller {
+	client := clientset.NewForConfigOrDie(kubeConfig)
+	c := &Controller{
+		KubeClient: client,
+		Config:     config,
+		kubeConfig: kubeConfig,
+		queue:      workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "kloader"),
+		informers:  newInformerFactory(config.ResyncPeriod),
+		mounters:   make(map[string]*Mounter),
+		selectors:  make(map[informerKey]*selectorSource),
+		selected:   make(map[string]informerKey),
+		pending:    make(changeSet),
+		rejected:   make(map[string]*rejection),
+		synced:     sets.NewString(),
+		waiting:    make(map[string]string),
+		echoes:     make(map[string]string),
+		dependents: make(map[informerKey]sets.String),
+	}
+	if config.EventRecorder != nil {
+		c.recorder = newEventRecorder(client, config.EventRecorder)
+	}
+	c.debouncer = newDebouncer(config.DebounceQuietPeriod, config.DebounceMaxWait, func(key string) { c.queue.Add(key) })
+	if config.Cmd != "" {
+		c.reloaders = append(c.reloaders, &hook{command: config.Cmd, timeout: config.HookTimeout})
+	}
+	if config.SignalProcess != nil {
+		c.reloaders = append(c.reloaders, &signaler{spec: *config.SignalProcess})
+	}
+	if config.Webhook != nil {
+		c.reloaders = append(c.reloaders, &webhook{spec: *config.Webhook})
+	}
+	return c
+}
+
+// AddSource projects the ConfigMap, Secret, Resource or Endpoints of src into
+// src.MountPath. If the namespace of the source is empty, the namespace of
+// the running pod is used. If the source has a selector, every matching
+// object is projected into a subdirectory of src.MountPath named after it.
+func (c *Controller) AddSource(src v1alpha1.Source) error {
+	var (
+		source Source
+		ref    *v1alpha1.ObjectReference
+	)
+	switch {
+	case src.ConfigMap != nil:
+		source, ref = NewConfigMapSource(c.KubeClient), src.ConfigMap
+	case src.Secret != nil:
+		source, ref = NewSecretSource(c.KubeClient), src.Secret
+	case src.Resource != nil:
+		r := src.Resource
+		var err error
+		gvr := schema.GroupVersionResource{Group: r.Group, Version: r.Version, Resource: r.Resource}
+		if source, err = NewResourceSource(c.kubeConfig, gvr, r.Fields); err != nil {
+			return err
+		}
+		ref = &r.ObjectReference
+	case src.Endpoints != nil:
+		e := src.Endpoints
+		var err error
+		if source, err = NewEndpointsSource(c.KubeClient, e.Template, e.TemplateFile, e.File); err != nil {
+			return err
+		}
+		ref = &e.ObjectReference
+	default:
+		return fmt.Errorf("ConfigMap/Secret/Resource/Endpoints is required, but not provided")
+	}
+	if ref.Selector != "" {
+		c.addSelector(source, ref.Namespace, ref.Selector, src)
+		return nil
+	}
+	return c.AddMounter(NewMounter(c.KubeClient, source, ref.Namespace, ref.Name, WithSpec(src)))
+}
+
+// AddMounter watches the object of m and projects it with m. It must be
+// called before Run, MountOnce or SyncOnce. It fails if the object of m is
+// projected by another mounter already, like a source without a namespace
+// and one with the namespace of the pod.
+func (c *Controller) AddMounter(m *Mounter) error {
+	key := m.key()
+	if other, found := c.mounters[key]; found {
+		return fmt.Errorf("%s is already mounted into %s", key, other.mountLocation)
+	}
+	c.informers.watch(m.source, m.namespace, m.name)
+	m.getObject = c.cachedObject
+	c.mounters[key] = m
+	return nil
+}
+
+// mounter returns the mounter of the source with queue key.
+func (c *Controller) mounter(key string) (*Mounter, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	m, found := c.mounters[key]
+	return m, found
+}
+
+// MountOnce gets every source from the API server and projects it into its
+// mount location, without starting any informer.
+func (c *Controller) MountOnce() error {
+	if err := c.listSelected(); err != nil {
+		return err
+	}
+	for key, m := range c.mounters {
+		obj, err := m.fetch()
+		if err != nil {
+			return fmt.Errorf("failed to get %s, cause %v", key, err)
+		}
+		if _, err := m.mountObject(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Inherit takes over the state of old, which c replaces after a configuration
+// change and which must be stopped: the changes old mounted but did not reload
+// yet are reloaded by c, and the versions old rejected are not mounted again
+// by c, unless the spec of their source changed. It must be called before Run.
+func (c *Controller) Inherit(old *Controller) {
+	for key, change := range old.pending {
+		c.addChange(key, change)
+	}
+	for key, r := range old.rejected {
+		if c.sameSource(old, key) {
+			c.rejected[key] = r
+		}
+	}
+}
+
+// sameSource reports whether c projects the source with queue key like old did.
+func (c *Controller) sameSource(old *Controller, key string) bool {
+	old.lock.RLock()
+	defer old.lock.RUnlock()
+	if sel, found := old.selected[key]; found {
+		s, found := c.selectors[sel]
+		return found && reflect.DeepEqual(s.spec, old.selectors[sel].spec)
+	}
+	m, found := c.mounters[key]
+	oldM, oldFound := old.mounters[key]
+	return found && oldFound && reflect.DeepEqual(m.spec, oldM.spec)
+}
+
+// Run watches the sources until stopCh is closed. It returns once the item
+// being processed, if any, is done.
+func (c *Controller) Run(stopCh <-chan struct{}) {
+	c.informers.start(c.eventHandler, stopCh)
+	c.watchWriteBack(stopCh)
+	go func() {
+		<-stopCh
+		c.queue.ShutDown()
+	}()
+	if len(c.selectors) > 0 {
+		go func() {
+			if cache.WaitForCacheSync(stopCh, c.informers.hasSynced) {
+				c.pruneSelected()
+			}
+		}()
+	}
+	wait.Until(c.runWorker, time.Second, stopCh)
+}
+
+// Healthy returns an error if the informers are not running or cannot list
+// and watch the sources.
+func (c *Controller) Healthy() error {
+	return c.informers.healthy()
+}
+
+// Ready returns an error until every source has been mounted and the
+// reloaders have succeeded for the mounted changes.
+func (c *Controller) Ready() error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	var missing []string
+	for key := range c.mounters {
+		if reason, found := c.waiting[key]; found {
+			missing = append(missing, key+" ("+reason+")")
+		} else if !c.synced.Has(key) {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("not mounted yet: %s", strings.Join(missing, ", "))
+	}
+	if len(c.selectors) > 0 && !c.informers.hasSynced() {
+		return fmt.Errorf("objects matching the selectors have not been listed yet")
+	}
+	if c.reloadPending {
+		return fmt.Errorf("mounted changes have not been reloaded yet")
+	}
+	return nil
+}
+
+func (c *Controller) eventHandler(informer informerKey) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			key, found := c.mounterKey(informer, obj, true)
+			if !found {
+				return
+			}
+			incUpdateReceivedCounter(key)
+			log.Infoln("Queued Add event", key)
+			c.debouncer.enqueue(key)
+		},
+		UpdateFunc: func(old, new interface{}) {
+			key, found := c.mounterKey(informer, new, true)
+			if !found {
+				return
+			}
+			incUpdateReceivedCounter(key)
+			if c.isEcho(key, new) {
+				log.Infoln("Ignored Update event written back by kloader", key)
+				return
+			}
+			if m, found := c.mounter(key); found && m.dataChanged(old, new) {
+				log.Infoln("Queued Update event", key)
+				c.debouncer.enqueue(key)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			key, found := c.mounterKey(informer, obj, false)
+			if !found {
+				return
+			}
+			log.Infoln("Queued Delete event", key)
+			c.debouncer.enqueue(key)
+		},
+	}
+}
+
+// mounterKey returns the queue key for obj and whether a mounter is
+// registered for it. If obj was received by the informer of a selector and
+// create is set, a mounter is registered for it if needed.
+func (c *Controller) mounterKey(informer informerKey, obj interface{}, create bool) (string, bool) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		log.Infoln(err)
+		return "", false
+	}
+	if informer.selector != "" && create {
+		return c.selectedMounter(informer, accessor.GetName())
+	}
+	key := queueKey(informer.kind, accessor.GetNamespace(), accessor.GetName())
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if informer.selector != "" {
+		owner, found := c.selected[key]
+		return key, found && owner == informer
+	}
+	_, found := c.mounters[key]
+	_, selected := c.selected[key]
+	return key, found && !selected
+}
+
+func (c *Controller) runWorker() {
+	for c.processNextItem() {
+		// continue looping
+	}
+}
+
+func (c *Controller) processNextItem() bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	err := c.processItem(key.(string))
+	if err == nil {
+		c.queue.Forget(key)
+	} else if _, waiting := err.(*requirementsError); waiting {
+		// an incomplete source is waited for without giving up
+		log.Infof("Waiting for %s: %v\n", key, err)
+		c.queue.AddRateLimited(key)
+	} else if c.queue.NumRequeues(key) < maxRetries {
+		log.Infof("Error processing %s (will retry): %v\n", key, err)
+		c.queue.AddRateLimited(key)
+	} else {
+		log.Infof("Error processing %s (giving up): %v\n", key, err)
+		c.queue.Forget(key)
+	}
+
+	return true
+}
+
+func (c *Controller) processItem(key string) error {
+	if key == reloadQueueKey {
+		return c.reload()
+	}
+	if strings.HasPrefix(key, writeBackQueuePrefix) {
+		return c.writeBack(strings.TrimPrefix(key, writeBackQueuePrefix))
+	}
+	log.Infof("Processing change to %s\n", key)
+
+	m, found := c.mounter(key)
+	if !found {
+		// the object no longer matches its selector and was removed
+		return nil
+	}
+	kind, namespace, name := splitQueueKey(key)
+	informer := informerKey{kind: kind, namespace: namespace, name: name}
+	c.lock.RLock()
+	if sel, found := c.selected[key]; found {
+		informer = sel
+	}
+	c.lock.RUnlock()
+	obj, exists, err := c.informers.get(informer, name)
+	if err != nil {
+		return fmt.Errorf("error fetching object with key %s from store: %v", key, err)
+	}
+
+	if !exists {
+		log.Infof("Not exists: %s\n", key)
+		if informer.selector != "" {
+			return c.removeSelected(key)
+		}
+		return c.handleDelete(key, m)
+	}
+	if err := c.createSelectedDir(key); err != nil {
+		return err
+	}
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	if r, found := c.rejected[key]; found && r.version == c.sourceVersion(r.references, accessor.GetResourceVersion()) {
+		log.Infof("Skipping %s, resourceVersion %s was rejected\n", key, accessor.GetResourceVersion())
+		// a controller that inherited the rejection does not watch them yet
+		c.watchReferences(key, r.references)
+		return nil
+	}
+
+	// handle the event
+	c.checkLocalChanges(key, m, accessor.GetResourceVersion())
+	change, err := m.mountObject(obj)
+	c.watchReferences(key, m.references)
+	c.setWaiting(key, err)
+	if _, rejected := err.(*validationError); rejected {
+		// retrying cannot help, so the source is skipped until it changes
+		log.Errorf("Rejected %s at resourceVersion %s: %v\n", key, accessor.GetResourceVersion(), err)
+		incValidationFailureCounter(key)
+		c.recorder.eventf([]*apiv1.ObjectReference{m.reference(accessor)}, apiv1.EventTypeWarning, eventReasonValidationFailed,
+			"Rejected %s at resourceVersion %s: %v", key, accessor.GetResourceVersion(), err)
+		c.reject(key, m, accessor.GetResourceVersion())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	delete(c.rejected, key)
+	setSynced(key, obj)
+	c.lock.Lock()
+	c.synced.Insert(key)
+	c.lock.Unlock()
+	if change != nil {
+		c.recorder.eventf([]*apiv1.ObjectReference{change.reference()}, apiv1.EventTypeNormal, eventReasonMounted,
+			"Mounted %s at resourceVersion %s into %s", key, change.resourceVersion, change.mountPath)
+	}
+	c.addChange(key, change)
+	if _, found := c.pending[key]; !found {
+		m.commit()
+	}
+	return nil
+}
+
+// rejection is a version of a source that failed validation or was rolled back.
+type rejection struct {
+	// version is the sourceVersion the source was rejected at.
+	version string
+	// references holds the objects the templates of the source read.
+	references map[informerKey]bool
+}
+
+// reject records that the files of m rendered from resourceVersion were
+// rejected. They are not mounted again until the object of m or any object
+// its templates read changes.
+func (c *Controller) reject(key string, m *Mounter, resourceVersion string) {
+	c.rejected[key] = &rejection{version: c.sourceVersion(m.references, resourceVersion), references: m.references}
+}
+
+// sourceVersion identifies what the files of a source are rendered from: the
+// resourceVersion of its object and of every object in refs, which its
+// templates read.
+func (c *Controller) sourceVersion(refs map[informerKey]bool, resourceVersion string) string {
+	if len(refs) == 0 {
+		return resourceVersion
+	}
+	versions := make([]string, 0, len(refs))
+	for ref := range refs {
+		refVersion := ""
+		if source := c.referenceSource(ref); source != nil {
+			if obj, err := c.cachedObject(source, ref.namespace, ref.name); err == nil {
+				if accessor, err := meta.Accessor(obj); err == nil {
+					refVersion = accessor.GetResourceVersion()
+				}
+			}
+		}
+		versions = append(versions, queueKey(ref.kind, ref.namespace, ref.name)+"="+refVersion)
+	}
+	sort.Strings(versions)
+	return resourceVersion + " " + strings.Join(versions, " ")
+}
+
+// addChange records a mounted change and schedules the reloaders to run after it.
+func (c *Controller) addChange(key string, change *change) {
+	if change == nil || len(c.reloaders) == 0 {
+		return
+	}
+	c.pending.add(key, change)
+	c.setReloadPending(true)
+	c.queue.Add(reloadQueueKey)
+}
+
+// reload runs the reloaders for the pending changes. It is postponed while
+// sources are queued, so that a set of changes to several sources results in
+// a single run. An error is retried with the rate limit of the queue.
+func (c *Controller) reload() error {
+	if len(c.pending) == 0 {
+		return nil
+	}
+	if c.queue.Len() > 0 {
+		c.queue.Add(reloadQueueKey)
+		return nil
+	}
+
+	if err := c.runReloaders(); err != nil {
+		return err
+	}
+	// changes that could not be rolled back are still pending
+	c.setReloadPending(len(c.pending) > 0)
+	return nil
+}
+
+// runReloaders runs every reloader for the pending changes, and clears them
+// once all succeeded. If the hook fails and RollbackOnFailure is set, the
+// pending changes are rolled back instead.
+func (c *Controller) runReloaders() error {
+	for _, r := range c.reloaders {
+		start := time.Now()
+		err := r.reload(c.pending)
+		observeReload(r.action(), start, err)
+		_, isHook := r.(*hook)
+		if isHook {
+			c.recordHookEvent(c.pending, err)
+		}
+		if err != nil {
+			if isHook && c.RollbackOnFailure {
+				return c.rollback(r, err)
+			}
+			return err
+		}
+	}
+	c.commit(c.pending)
+	c.pending = make(changeSet)
+	return nil
+}
+
+func (c *Controller) recordHookEvent(changes changeSet, err error) {
+	if err != nil {
+		c.recorder.eventf(eventSources(changes), apiv1.EventTypeWarning, eventReasonHookFailed,
+			"Boot command failed for %s: %v", describeSources(changes), err)
+	} else {
+		c.recorder.eventf(eventSources(changes), apiv1.EventTypeNormal, eventReasonHookSucceeded,
+			"Boot command succeeded for %s", describeSources(changes))
+	}
+}
+
+// setWaiting records the unmet requirements of a source if err is a
+// *requirementsError, and clears them otherwise.
+func (c *Controller) setWaiting(key string, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if reqErr, ok := err.(*requirementsError); ok {
+		c.waiting[key] = reqErr.Error()
+	} else {
+		delete(c.waiting, key)
+	}
+}
+
+func (c *Controller) setReloadPending(pending bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.reloadPending = pending
+}
+
+// handleDelete applies the OnDelete policy to the deleted source of m.
+func (c *Controller) handleDelete(key string, m *Mounter) error {
+	delete(c.rejected, key)
+	switch c.OnDelete {
+	case v1alpha1.DeletePolicyClear:
+		change, err := m.clear()
+		if err != nil {
+			return err
+		}
+		c.addChange(key, change)
+	case v1alpha1.DeletePolicyHook:
+		kind, namespace, name := splitQueueKey(key)
+		h := &hook{command: c.OnDeleteCmd, timeout: c.HookTimeout}
+		if err := h.run((&change{kind: kind, namespace: namespace, name: name}).env()); err != nil {
+			return err
+		}
+	default:
+		log.Infof("Keeping mounted files of deleted %s\n", key)
+	}
+	incDeleteCounter(key, c.OnDelete)
+	policy := c.OnDelete
+	if policy == "" {
+		policy = v1alpha1.DeletePolicyKeep
+	}
+	c.recorder.eventf([]*apiv1.ObjectReference{m.reference(nil)}, apiv1.EventTypeNormal, eventReasonSourceDeleted,
+		"%s was deleted, applied on-delete policy %s", key, policy)
+	return nil
+}
+
+func queueKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+func splitQueueKey(key string) (kind, namespace, name string) {
+	parts := strings.SplitN(key, "/", 3)
+	return parts[0], parts[1], parts[2]
+}
@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+// newTestController returns a controller without an API server. The objects
+// of the mounters added by addTestMounter are read from caches filled by the test.
+func newTestController(config Config) *Controller {
+	return New(&rest.Config{Host: "http://127.0.0.1:1"}, config)
+}
+
+// addTestMounter adds m to c and returns the cache its objects are read from.
+func addTestMounter(t *testing.T, c *Controller, m *Mounter) cache.Indexer {
+	if err := c.AddMounter(m); err != nil {
+		t.Fatal(err)
+	}
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, m.source.NewObject(), 0, cache.Indexers{})
+	c.informers.informers[informerKey{kind: m.source.Kind(), namespace: m.namespace, name: m.name}] = informer
+	return informer.GetIndexer()
+}
+
+func testSecret(resourceVersion, data string) *apiv1.Secret {
+	return &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", UID: "uid", ResourceVersion: resourceVersion},
+		Data:       map[string][]byte{"app.conf": []byte(data)},
+	}
+}
+
+func TestHandleDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kloader-delete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		name   string
+		policy v1alpha1.DeletePolicy
+		// kept is set if the files must still be mounted after the deletion
+		kept bool
+		// reload is set if the deletion must run the reloaders
+		reload bool
+		// hookRan is set if the on-delete hook must have run
+		hookRan bool
+	}{
+		{name: "default", kept: true},
+		{name: "keep", policy: v1alpha1.DeletePolicyKeep, kept: true},
+		{name: "clear", policy: v1alpha1.DeletePolicyClear, reload: true},
+		{name: "hook", policy: v1alpha1.DeletePolicyHook, kept: true, hookRan: true},
+	}
+	for _, c := range cases {
+		mountPath := filepath.Join(dir, c.name)
+		if err := os.Mkdir(mountPath, 0755); err != nil {
+			t.Fatal(err)
+		}
+		marker := filepath.Join(dir, c.name+".deleted")
+		ctrl := newTestController(Config{
+			Cmd:         "true",
+			OnDelete:    c.policy,
+			OnDeleteCmd: `echo -n "$KLOADER_SOURCE_NAMESPACE/$KLOADER_SOURCE_NAME" > ` + marker,
+		})
+		store := addTestMounter(t, ctrl, NewMounter(nil, NewSecretSource(nil), "default", "app", WithMountPath(mountPath)))
+		key := queueKey(kindSecret, "default", "app")
+		file := filepath.Join(mountPath, "app.conf")
+
+		store.Add(testSecret("1", "v1"))
+		if err := ctrl.processItem(key); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if err := ctrl.runReloaders(); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		store.Delete(testSecret("1", "v1"))
+		if err := ctrl.processItem(key); err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+			continue
+		}
+		data, err := ioutil.ReadFile(file)
+		if c.kept && (err != nil || string(data) != "v1") {
+			t.Errorf("%s: expected app.conf to be kept, found %q: %v", c.name, data, err)
+		} else if !c.kept && !os.IsNotExist(err) {
+			t.Errorf("%s: expected app.conf to be removed, found %q: %v", c.name, data, err)
+		}
+		if _, pending := ctrl.pending[key]; pending != c.reload {
+			t.Errorf("%s: expected reload pending %v, found %v", c.name, c.reload, pending)
+		}
+		data, err = ioutil.ReadFile(marker)
+		if c.hookRan && string(data) != "default/app" {
+			t.Errorf("%s: expected the on-delete hook to run for default/app, found %q: %v", c.name, data, err)
+		} else if !c.hookRan && !os.IsNotExist(err) {
+			t.Errorf("%s: expected the on-delete hook not to run, found %v", c.name, err)
+		}
+
+		// a re-created object is mounted again
+		store.Add(testSecret("2", "v2"))
+		if err := ctrl.processItem(key); err != nil {
+			t.Errorf("%s: unexpected error after re-creating: %v", c.name, err)
+			continue
+		}
+		if data, err := ioutil.ReadFile(file); err != nil || string(data) != "v2" {
+			t.Errorf("%s: expected the re-created object to be mounted, found %q: %v", c.name, data, err)
+		}
+		if _, pending := ctrl.pending[key]; !pending {
+			t.Errorf("%s: expected the re-created object to run the reloaders", c.name)
+		}
+	}
+}
+
+func TestHealthy(t *testing.T) {
+	ctrl := newTestController(Config{})
+	if err := ctrl.Healthy(); err == nil || !strings.Contains(err.Error(), "not running") {
+		t.Errorf("expected an error before the informers run, found %v", err)
+	}
+	ctrl.informers.setRunning(true)
+	if err := ctrl.Healthy(); err != nil {
+		t.Errorf("unexpected error while running: %v", err)
+	}
+	key := informerKey{kind: kindSecret, namespace: "default", name: "app"}
+	ctrl.informers.setError(key, fmt.Errorf("connection refused"))
+	if err := ctrl.Healthy(); err == nil || !strings.Contains(err.Error(), "failed to watch secret default/app, cause connection refused") {
+		t.Errorf("expected the watch error, found %v", err)
+	}
+	ctrl.informers.setError(key, nil)
+	if err := ctrl.Healthy(); err != nil {
+		t.Errorf("unexpected error after the watch recovered: %v", err)
+	}
+}
+
+func TestReady(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kloader-ready")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctrl := newTestController(Config{Cmd: "true"})
+	spec := v1alpha1.Source{Require: &v1alpha1.Requirements{Keys: []string{"app.conf"}}}
+	store := addTestMounter(t, ctrl, NewMounter(nil, NewSecretSource(nil), "default", "app", WithSpec(spec), WithMountPath(dir)))
+	key := queueKey(kindSecret, "default", "app")
+
+	if err := ctrl.Ready(); err == nil || !strings.Contains(err.Error(), "not mounted yet: "+key) {
+		t.Errorf("expected not ready before the first mount, found %v", err)
+	}
+
+	incomplete := testSecret("1", "")
+	incomplete.Data = map[string][]byte{"other.conf": []byte("other")}
+	store.Add(incomplete)
+	if err := ctrl.processItem(key); err == nil {
+		t.Errorf("expected the incomplete Secret to be waited for")
+	}
+	if err := ctrl.Ready(); err == nil || !strings.Contains(err.Error(), key+" (") || !strings.Contains(err.Error(), "app.conf") {
+		t.Errorf("expected the missing key to be reported, found %v", err)
+	}
+
+	store.Update(testSecret("2", "v2"))
+	if err := ctrl.processItem(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctrl.Ready(); err == nil || !strings.Contains(err.Error(), "not been reloaded") {
+		t.Errorf("expected not ready before the boot command ran, found %v", err)
+	}
+	// the boot command is queued after the mount
+	ctrl.processNextItem()
+	if err := ctrl.Ready(); err != nil {
+		t.Errorf("unexpected error after the boot command ran: %v", err)
+	}
+}
+
+func TestAddSourceTwice(t *testing.T) {
+	ctrl := newTestController(Config{})
+	if err := ctrl.AddSource(v1alpha1.Source{ConfigMap: &v1alpha1.ObjectReference{Name: "app"}, MountPath: "/etc/a"}); err != nil {
+		t.Fatal(err)
+	}
+	// the namespace of the pod is the default of a source without one
+	err := ctrl.AddSource(v1alpha1.Source{ConfigMap: &v1alpha1.ObjectReference{Namespace: namespace(), Name: "app"}, MountPath: "/etc/b"})
+	if err == nil || !strings.Contains(err.Error(), "is already mounted into /etc/a") {
+		t.Errorf("expected the ConfigMap mounted twice to be rejected, found %v", err)
+	}
+	if m := ctrl.mounters[queueKey(kindConfigMap, namespace(), "app")]; m.mountLocation != "/etc/a" {
+		t.Errorf("expected the first mounter to be kept, found %s", m.mountLocation)
+	}
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"sync"
+	"time"
+)
+
+// debouncer delays adding a key to the queue until no event for it arrived
+// for quietPeriod, or maxWait passed since its first event, so that a burst
+// of updates results in a single mount.
+type debouncer struct {
+	quietPeriod time.Duration
+	// maxWait is not enforced if zero.
+	maxWait time.Duration
+	add     func(key string)
+
+	lock    sync.Mutex
+	pending map[string]*debounced
+}
+
+type debounced struct {
+	timer *time.Timer
+	first time.Time
+}
+
+func newDebouncer(quietPeriod, maxWait time.Duration, add func(key string)) *debouncer {
+	return &debouncer{
+		quietPeriod: quietPeriod,
+		maxWait:     maxWait,
+		add:         add,
+		pending:     make(map[string]*debounced),
+	}
+}
+
+// enqueue adds key to the queue once the burst it belongs to is over. Without
+// a quiet period, key is added right away.
+func (d *debouncer) enqueue(key string) {
+	if d.quietPeriod <= 0 {
+		d.add(key)
+		return
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if p, found := d.pending[key]; found {
+		incCoalescedCounter(key)
+		delay := d.quietPeriod
+		if d.maxWait > 0 {
+			if left := d.maxWait - time.Since(p.first); left < delay {
+				delay = left
+			}
+		}
+		p.timer.Reset(delay)
+		return
+	}
+	p := &debounced{first: time.Now()}
+	p.timer = time.AfterFunc(d.quietPeriod, func() { d.fire(key, p) })
+	d.pending[key] = p
+}
+
+func (d *debouncer) fire(key string, p *debounced) {
+	d.lock.Lock()
+	// the timer may fire again if it was reset while firing
+	if d.pending[key] != p {
+		d.lock.Unlock()
+		return
+	}
+	delete(d.pending, key)
+	d.lock.Unlock()
+	d.add(key)
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDebouncer(t *testing.T) {
+	const (
+		a = "configmap/default/a"
+		b = "configmap/default/b"
+	)
+	type event struct {
+		at  time.Duration
+		key string
+	}
+	cases := []struct {
+		name        string
+		quietPeriod time.Duration
+		maxWait     time.Duration
+		events      []event
+		// adds is the number of times every key is added to the queue
+		adds map[string]int
+		// before is when the first add must have happened, if set
+		before time.Duration
+		// after is when the first add may happen at the earliest
+		after time.Duration
+	}{
+		{
+			name:   "no quiet period",
+			events: []event{{0, a}, {0, a}, {0, a}},
+			adds:   map[string]int{a: 3},
+		},
+		{
+			name:        "burst is coalesced",
+			quietPeriod: 100 * time.Millisecond,
+			events:      []event{{0, a}, {20 * time.Millisecond, a}, {40 * time.Millisecond, a}},
+			adds:        map[string]int{a: 1},
+			after:       140 * time.Millisecond,
+		},
+		{
+			name:        "separate bursts",
+			quietPeriod: 50 * time.Millisecond,
+			events:      []event{{0, a}, {10 * time.Millisecond, a}, {200 * time.Millisecond, a}},
+			adds:        map[string]int{a: 2},
+		},
+		{
+			name:        "keys are debounced separately",
+			quietPeriod: 100 * time.Millisecond,
+			events:      []event{{0, a}, {10 * time.Millisecond, b}, {20 * time.Millisecond, a}, {30 * time.Millisecond, b}},
+			adds:        map[string]int{a: 1, b: 1},
+		},
+		{
+			name:        "max wait ends a long burst",
+			quietPeriod: 100 * time.Millisecond,
+			maxWait:     120 * time.Millisecond,
+			events: []event{
+				{0, a}, {50 * time.Millisecond, a}, {100 * time.Millisecond, a},
+				{160 * time.Millisecond, a}, {210 * time.Millisecond, a}, {260 * time.Millisecond, a},
+			},
+			adds:   map[string]int{a: 2},
+			before: 150 * time.Millisecond,
+			after:  120 * time.Millisecond,
+		},
+	}
+	for _, c := range cases {
+		var (
+			lock  sync.Mutex
+			adds  = make(map[string]int)
+			first time.Duration
+		)
+		start := time.Now()
+		d := newDebouncer(c.quietPeriod, c.maxWait, func(key string) {
+			lock.Lock()
+			defer lock.Unlock()
+			if len(adds) == 0 {
+				first = time.Since(start)
+			}
+			adds[key]++
+		})
+		for _, e := range c.events {
+			time.Sleep(e.at - time.Since(start))
+			d.enqueue(e.key)
+		}
+		time.Sleep(c.quietPeriod + c.maxWait + 100*time.Millisecond)
+
+		lock.Lock()
+		for key, n := range c.adds {
+			if adds[key] != n {
+				t.Errorf("%s: expected %s to be added %d times, found %d", c.name, key, n, adds[key])
+			}
+		}
+		if c.before > 0 && first >= c.before {
+			t.Errorf("%s: expected the first add before %v, found %v", c.name, c.before, first)
+		}
+		if first < c.after {
+			t.Errorf("%s: expected the first add after %v, found %v", c.name, c.after, first)
+		}
+		lock.Unlock()
+	}
+}
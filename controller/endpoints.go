@@ -0,0 +1,193 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"text/template"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	kindEndpoints = "endpoints"
+
+	endpointsDefaultMode int32 = 0644
+	defaultEndpointsFile       = "endpoints"
+)
+
+// endpointsData is passed to the template of an Endpoints source. Only ready
+// addresses are included, and everything is sorted so that the output only
+// changes if the backends do.
+type endpointsData struct {
+	Name      string
+	Namespace string
+	Subsets   []endpointSubset
+	// Backends holds every ready address with every port of its subset.
+	Backends []backend
+}
+
+type endpointSubset struct {
+	Addresses []endpointAddress
+	Ports     []endpointPort
+}
+
+type endpointAddress struct {
+	IP       string
+	Hostname string
+	NodeName string
+	// PodName is the name of the pod behind the address, if any.
+	PodName string
+}
+
+type endpointPort struct {
+	Name     string
+	Port     int32
+	Protocol string
+}
+
+type backend struct {
+	IP       string
+	Hostname string
+	NodeName string
+	PodName  string
+	Port     int32
+	PortName string
+	Protocol string
+}
+
+// NewEndpointsSource renders the ready addresses and ports of the Endpoints
+// of a Service with a text/template into file. The template is text, or read
+// from templateFile if text is empty.
+func NewEndpointsSource(client clientset.Interface, text, templateFile, file string) (Source, error) {
+	if text == "" {
+		data, err := ioutil.ReadFile(templateFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template, cause %v", err)
+		}
+		text = string(data)
+	}
+	tmpl, err := template.New(kindEndpoints).Funcs(templateFuncs()).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template, cause %v", err)
+	}
+	if file == "" {
+		file = defaultEndpointsFile
+	}
+	return &endpointsSource{client: client, template: tmpl, file: file}, nil
+}
+
+type endpointsSource struct {
+	client   clientset.Interface
+	template *template.Template
+	file     string
+}
+
+func (s *endpointsSource) Kind() string { return kindEndpoints }
+
+func (s *endpointsSource) GroupVersionKind() schema.GroupVersionKind {
+	return apiv1.SchemeGroupVersion.WithKind("Endpoints")
+}
+
+func (s *endpointsSource) DefaultMode() int32 { return endpointsDefaultMode }
+
+func (s *endpointsSource) NewObject() runtime.Object { return &apiv1.Endpoints{} }
+
+func (s *endpointsSource) ListWatch(namespace string, tweak func(*metav1.ListOptions)) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			tweak(&opts)
+			return s.client.CoreV1().Endpoints(namespace).List(opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			tweak(&opts)
+			return s.client.CoreV1().Endpoints(namespace).Watch(opts)
+		},
+	}
+}
+
+func (s *endpointsSource) Get(namespace, name string) (runtime.Object, error) {
+	return s.client.CoreV1().Endpoints(namespace).Get(name, metav1.GetOptions{})
+}
+
+// Data renders the template into a single key, named after the file.
+func (s *endpointsSource) Data(obj runtime.Object) (map[string][]byte, error) {
+	endpoints, ok := obj.(*apiv1.Endpoints)
+	if !ok {
+		return nil, fmt.Errorf("expected Endpoints, found %T", obj)
+	}
+	var buf bytes.Buffer
+	if err := s.template.Execute(&buf, newEndpointsData(endpoints)); err != nil {
+		return nil, fmt.Errorf("failed to render Endpoints %s/%s, cause %v", endpoints.Namespace, endpoints.Name, err)
+	}
+	return map[string][]byte{s.file: buf.Bytes()}, nil
+}
+
+// DataChanged ignores updates that do not change the ready addresses or
+// ports, like a change of the addresses that are not ready.
+func (s *endpointsSource) DataChanged(old, new runtime.Object) bool {
+	if oldEndpoints, oldOK := old.(*apiv1.Endpoints); oldOK {
+		if newEndpoints, newOK := new.(*apiv1.Endpoints); newOK {
+			return !reflect.DeepEqual(newEndpointsData(oldEndpoints), newEndpointsData(newEndpoints))
+		}
+	}
+	return false
+}
+
+func newEndpointsData(endpoints *apiv1.Endpoints) endpointsData {
+	data := endpointsData{Name: endpoints.Name, Namespace: endpoints.Namespace}
+	for _, ss := range endpoints.Subsets {
+		if len(ss.Addresses) == 0 {
+			continue
+		}
+		var subset endpointSubset
+		for _, a := range ss.Addresses {
+			addr := endpointAddress{IP: a.IP, Hostname: a.Hostname}
+			if a.NodeName != nil {
+				addr.NodeName = *a.NodeName
+			}
+			if a.TargetRef != nil && a.TargetRef.Kind == "Pod" {
+				addr.PodName = a.TargetRef.Name
+			}
+			subset.Addresses = append(subset.Addresses, addr)
+		}
+		for _, p := range ss.Ports {
+			subset.Ports = append(subset.Ports, endpointPort{Name: p.Name, Port: p.Port, Protocol: string(p.Protocol)})
+		}
+		sort.Slice(subset.Addresses, func(i, j int) bool { return subset.Addresses[i].IP < subset.Addresses[j].IP })
+		sort.Slice(subset.Ports, func(i, j int) bool { return subset.Ports[i].Port < subset.Ports[j].Port })
+		data.Subsets = append(data.Subsets, subset)
+
+		for _, a := range subset.Addresses {
+			for _, p := range subset.Ports {
+				data.Backends = append(data.Backends, backend{
+					IP:       a.IP,
+					Hostname: a.Hostname,
+					NodeName: a.NodeName,
+					PodName:  a.PodName,
+					Port:     p.Port,
+					PortName: p.Name,
+					Protocol: p.Protocol,
+				})
+			}
+		}
+	}
+	sort.Slice(data.Subsets, func(i, j int) bool {
+		return data.Subsets[i].Addresses[0].IP < data.Subsets[j].Addresses[0].IP
+	})
+	sort.Slice(data.Backends, func(i, j int) bool {
+		if data.Backends[i].IP != data.Backends[j].IP {
+			return data.Backends[i].IP < data.Backends[j].IP
+		}
+		return data.Backends[i].Port < data.Backends[j].Port
+	})
+	return data
+}
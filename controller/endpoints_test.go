@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testEndpoints(subsets ...apiv1.EndpointSubset) *apiv1.Endpoints {
+	return &apiv1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Subsets:    subsets,
+	}
+}
+
+func addresses(ips ...string) []apiv1.EndpointAddress {
+	var addrs []apiv1.EndpointAddress
+	for _, ip := range ips {
+		addrs = append(addrs, apiv1.EndpointAddress{IP: ip})
+	}
+	return addrs
+}
+
+func ports(ports ...int32) []apiv1.EndpointPort {
+	var eps []apiv1.EndpointPort
+	for _, port := range ports {
+		eps = append(eps, apiv1.EndpointPort{Port: port, Protocol: apiv1.ProtocolTCP})
+	}
+	return eps
+}
+
+func TestEndpointsData(t *testing.T) {
+	const text = `{{ .Namespace }}/{{ .Name }}:{{ range .Backends }} {{ .IP }}:{{ .Port }}{{ if .PodName }}({{ .PodName }}@{{ .NodeName }}){{ end }}{{ end }}`
+	node := "node-1"
+	cases := []struct {
+		name      string
+		endpoints *apiv1.Endpoints
+		rendered  string
+	}{
+		{
+			name:      "no subsets",
+			endpoints: testEndpoints(),
+			rendered:  "default/web:",
+		},
+		{
+			name: "only ready addresses",
+			endpoints: testEndpoints(apiv1.EndpointSubset{
+				Addresses:         addresses("10.0.0.2"),
+				NotReadyAddresses: addresses("10.0.0.1"),
+				Ports:             ports(80),
+			}),
+			rendered: "default/web: 10.0.0.2:80",
+		},
+		{
+			name: "subset without ready addresses",
+			endpoints: testEndpoints(
+				apiv1.EndpointSubset{NotReadyAddresses: addresses("10.0.0.1"), Ports: ports(80)},
+				apiv1.EndpointSubset{Addresses: addresses("10.0.0.3"), Ports: ports(8080)},
+			),
+			rendered: "default/web: 10.0.0.3:8080",
+		},
+		{
+			name: "sorted by address and port",
+			endpoints: testEndpoints(
+				apiv1.EndpointSubset{Addresses: addresses("10.0.0.4", "10.0.0.2"), Ports: ports(443, 80)},
+				apiv1.EndpointSubset{Addresses: addresses("10.0.0.3"), Ports: ports(8080)},
+			),
+			rendered: "default/web: 10.0.0.2:80 10.0.0.2:443 10.0.0.3:8080 10.0.0.4:80 10.0.0.4:443",
+		},
+		{
+			name: "pod and node",
+			endpoints: testEndpoints(apiv1.EndpointSubset{
+				Addresses: []apiv1.EndpointAddress{{
+					IP:        "10.0.0.2",
+					NodeName:  &node,
+					TargetRef: &apiv1.ObjectReference{Kind: "Pod", Name: "web-0"},
+				}},
+				Ports: ports(80),
+			}),
+			rendered: "default/web: 10.0.0.2:80(web-0@node-1)",
+		},
+	}
+	for _, c := range cases {
+		source, err := NewEndpointsSource(nil, text, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := source.Data(c.endpoints)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+			continue
+		}
+		if len(data) != 1 || string(data[defaultEndpointsFile]) != c.rendered {
+			t.Errorf("%s: expected %s to contain %q, found %q", c.name, defaultEndpointsFile, c.rendered, data)
+		}
+	}
+}
+
+func TestEndpointsDataChanged(t *testing.T) {
+	old := testEndpoints(
+		apiv1.EndpointSubset{Addresses: addresses("10.0.0.1", "10.0.0.2"), NotReadyAddresses: addresses("10.0.0.9"), Ports: ports(80)},
+		apiv1.EndpointSubset{Addresses: addresses("10.0.0.3"), Ports: ports(8080)},
+	)
+	cases := []struct {
+		name    string
+		new     *apiv1.Endpoints
+		changed bool
+	}{
+		{
+			name: "reordered",
+			new: testEndpoints(
+				apiv1.EndpointSubset{Addresses: addresses("10.0.0.3"), Ports: ports(8080)},
+				apiv1.EndpointSubset{Addresses: addresses("10.0.0.2", "10.0.0.1"), NotReadyAddresses: addresses("10.0.0.9"), Ports: ports(80)},
+			),
+		},
+		{
+			name: "not ready address changed",
+			new: testEndpoints(
+				apiv1.EndpointSubset{Addresses: addresses("10.0.0.1", "10.0.0.2"), NotReadyAddresses: addresses("10.0.0.8"), Ports: ports(80)},
+				apiv1.EndpointSubset{Addresses: addresses("10.0.0.3"), Ports: ports(8080)},
+			),
+		},
+		{
+			name: "address became ready",
+			new: testEndpoints(
+				apiv1.EndpointSubset{Addresses: addresses("10.0.0.1", "10.0.0.2", "10.0.0.9"), Ports: ports(80)},
+				apiv1.EndpointSubset{Addresses: addresses("10.0.0.3"), Ports: ports(8080)},
+			),
+			changed: true,
+		},
+		{
+			name: "port added",
+			new: testEndpoints(
+				apiv1.EndpointSubset{Addresses: addresses("10.0.0.1", "10.0.0.2"), NotReadyAddresses: addresses("10.0.0.9"), Ports: ports(80, 443)},
+				apiv1.EndpointSubset{Addresses: addresses("10.0.0.3"), Ports: ports(8080)},
+			),
+			changed: true,
+		},
+		{
+			name: "subset removed",
+			new: testEndpoints(
+				apiv1.EndpointSubset{Addresses: addresses("10.0.0.1", "10.0.0.2"), NotReadyAddresses: addresses("10.0.0.9"), Ports: ports(80)},
+			),
+			changed: true,
+		},
+	}
+	source, err := NewEndpointsSource(nil, "{{ .Backends }}", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		if changed := source.DataChanged(old, c.new); changed != c.changed {
+			t.Errorf("%s: expected changed %v, found %v", c.name, c.changed, changed)
+		}
+	}
+}
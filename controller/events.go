@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/appscode/go/log"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	eventComponent = "kloader"
+
+	eventReasonMounted           = "Mounted"
+	eventReasonHookSucceeded     = "HookSucceeded"
+	eventReasonHookFailed        = "HookFailed"
+	eventReasonValidationFailed  = "ValidationFailed"
+	eventReasonSourceDeleted     = "SourceDeleted"
+	eventReasonRolledBack        = "RolledBack"
+	eventReasonWrittenBack       = "WrittenBack"
+	eventReasonWriteBackConflict = "WriteBackConflict"
+)
+
+// eventRecorder creates Events about the sources and the pod kloader runs in,
+// so that `kubectl describe` shows which pods picked up a change. Events are
+// sent in the background and repeated Events are aggregated, like those of
+// the kubelet.
+type eventRecorder struct {
+	client   clientset.Interface
+	recorder record.EventRecorder
+
+	podOnce sync.Once
+	pod     *apiv1.ObjectReference
+}
+
+// NewEventRecorder starts a broadcaster that sends Events to the API server
+// and returns a recorder for Config.EventRecorder. The broadcaster runs for
+// the lifetime of the process, so a single recorder should be shared by all
+// controllers.
+func NewEventRecorder(client clientset.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&corev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, apiv1.EventSource{Component: eventComponent, Host: os.Getenv("NODE_NAME")})
+}
+
+func newEventRecorder(client clientset.Interface, recorder record.EventRecorder) *eventRecorder {
+	return &eventRecorder{client: client, recorder: recorder}
+}
+
+// eventf records an Event on every source and a single Event on the pod.
+func (r *eventRecorder) eventf(sources []*apiv1.ObjectReference, eventType, reason, format string, args ...interface{}) {
+	if r == nil {
+		return
+	}
+	message := fmt.Sprintf(format, args...)
+	for _, source := range sources {
+		r.recorder.Event(source, eventType, reason, message)
+	}
+	if pod := r.podReference(); pod != nil {
+		r.recorder.Event(pod, eventType, reason, message)
+	}
+}
+
+// podReference returns the pod named by the POD_NAME and POD_NAMESPACE
+// environment variables, or nil if POD_NAME is not set.
+func (r *eventRecorder) podReference() *apiv1.ObjectReference {
+	r.podOnce.Do(func() {
+		name := os.Getenv("POD_NAME")
+		if name == "" {
+			return
+		}
+		ns := os.Getenv("POD_NAMESPACE")
+		if ns == "" {
+			ns = namespace()
+		}
+		r.pod = &apiv1.ObjectReference{Kind: "Pod", APIVersion: "v1", Namespace: ns, Name: name}
+		// the uid lets `kubectl describe pod` find the Events
+		if pod, err := r.client.CoreV1().Pods(ns).Get(name, metav1.GetOptions{}); err == nil {
+			r.pod.UID = pod.UID
+		} else {
+			log.Errorf("Failed to get pod %s/%s, cause %v\n", ns, name, err)
+		}
+	})
+	return r.pod
+}
+
+// eventSources returns the references of the sources in changes.
+func eventSources(changes changeSet) []*apiv1.ObjectReference {
+	refs := make([]*apiv1.ObjectReference, 0, len(changes))
+	for _, key := range changes.sources() {
+		refs = append(refs, changes[key].reference())
+	}
+	return refs
+}
+
+// describeSources returns a list of the sources in changes for a message.
+func describeSources(changes changeSet) string {
+	sources := make([]string, 0, len(changes))
+	for _, key := range changes.sources() {
+		c := changes[key]
+		sources = append(sources, fmt.Sprintf("%s %s/%s", c.kind, c.namespace, c.name))
+	}
+	return strings.Join(sources, ", ")
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// testRecorder records the Events created by a controller along with the
+// object they are about.
+type testRecorder struct {
+	events []string
+}
+
+func (r *testRecorder) Event(object runtime.Object, eventType, reason, message string) {
+	ref := object.(*apiv1.ObjectReference)
+	r.events = append(r.events, fmt.Sprintf("%s %s/%s: %s %s %s", ref.Kind, ref.Namespace, ref.Name, eventType, reason, message))
+}
+
+func (r *testRecorder) Eventf(object runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventType, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *testRecorder) PastEventf(object runtime.Object, timestamp metav1.Time, eventType, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventType, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func TestEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kloader-events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("POD_NAME", "web-0")
+	os.Setenv("POD_NAMESPACE", "web")
+	defer os.Unsetenv("POD_NAME")
+	defer os.Unsetenv("POD_NAMESPACE")
+
+	cases := []struct {
+		name   string
+		cmd    string
+		events []string
+	}{
+		{
+			name: "hook succeeded",
+			cmd:  "true",
+			events: []string{
+				"Secret default/app: Normal Mounted Mounted secret/default/app at resourceVersion 1 into " + dir,
+				"Pod web/web-0: Normal Mounted Mounted secret/default/app at resourceVersion 1 into " + dir,
+				"Secret default/app: Normal HookSucceeded Boot command succeeded for secret default/app",
+				"Pod web/web-0: Normal HookSucceeded Boot command succeeded for secret default/app",
+			},
+		},
+		{
+			name: "hook failed",
+			cmd:  "false",
+			events: []string{
+				"Secret default/app: Normal Mounted Mounted secret/default/app at resourceVersion 1 into " + dir,
+				"Pod web/web-0: Normal Mounted Mounted secret/default/app at resourceVersion 1 into " + dir,
+				"Secret default/app: Warning HookFailed Boot command failed for secret default/app: hook \"false\" exited with status 1: ",
+				"Pod web/web-0: Warning HookFailed Boot command failed for secret default/app: hook \"false\" exited with status 1: ",
+			},
+		},
+	}
+	for _, c := range cases {
+		recorder := &testRecorder{}
+		ctrl := newTestController(Config{Cmd: c.cmd, EventRecorder: recorder})
+		store := addTestMounter(t, ctrl, NewMounter(nil, NewSecretSource(nil), "default", "app", WithMountPath(dir)))
+		key := queueKey(kindSecret, "default", "app")
+
+		store.Add(testSecret("1", c.name))
+		if err := ctrl.processItem(key); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		ctrl.runReloaders()
+		if !reflect.DeepEqual(recorder.events, c.events) {
+			t.Errorf("%s: expected events %q, found %q", c.name, c.events, recorder.events)
+		}
+	}
+}
+
+func TestEventsWithoutPod(t *testing.T) {
+	os.Unsetenv("POD_NAME")
+	recorder := &testRecorder{}
+	r := newEventRecorder(nil, recorder)
+	changes := changeSet{
+		"secret/default/tls":      {kind: "secret", gvk: apiv1.SchemeGroupVersion.WithKind("Secret"), namespace: "default", name: "tls"},
+		"configmap/default/nginx": {kind: "configmap", gvk: apiv1.SchemeGroupVersion.WithKind("ConfigMap"), namespace: "default", name: "nginx"},
+	}
+	r.eventf(eventSources(changes), apiv1.EventTypeNormal, eventReasonHookSucceeded, "Boot command succeeded for %s", describeSources(changes))
+
+	expected := []string{
+		"ConfigMap default/nginx: Normal HookSucceeded Boot command succeeded for configmap default/nginx, secret default/tls",
+		"Secret default/tls: Normal HookSucceeded Boot command succeeded for configmap default/nginx, secret default/tls",
+	}
+	if !reflect.DeepEqual(recorder.events, expected) {
+		t.Errorf("expected events %q, found %q", expected, recorder.events)
+	}
+
+	// a nil recorder, used when Events are disabled, records nothing
+	var disabled *eventRecorder
+	disabled.eventf(eventSources(changes), apiv1.EventTypeNormal, eventReasonHookSucceeded, "ignored")
+}
@@ -0,0 +1,216 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/appscode/go/log"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// reloader makes the application pick up a set of mounted changes.
+type reloader interface {
+	// action names the reloader in metrics.
+	action() string
+	reload(changes changeSet) error
+}
+
+// hook is a command run by `sh -c` after files were mounted or a source was deleted.
+type hook struct {
+	command string
+	timeout time.Duration
+	// dir is the working directory of the command, if set.
+	dir string
+}
+
+func (h *hook) action() string { return "hook" }
+
+func (h *hook) reload(changes changeSet) error {
+	return h.run(changes.env())
+}
+
+// exitError is returned by hook.run if the command ran and exited non-zero.
+type exitError struct {
+	command string
+	status  int
+	stderr  string
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("hook %q exited with status %d: %s", e.command, e.status, e.stderr)
+}
+
+// run executes the hook with env added to the environment of kloader. It
+// returns an *exitError if the command exits non-zero, and another error if
+// it cannot be started, is killed or does not finish in time.
+func (h *hook) run(env []string) error {
+	ctx := context.Background()
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", h.command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Dir = h.dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	log.Infoln("Running hook", h.command)
+	err := runProcessGroup(ctx, cmd)
+	if stdout.Len() > 0 {
+		log.Infoln("Hook stdout:\n", stdout.String())
+	}
+	if stderr.Len() > 0 {
+		log.Infoln("Hook stderr:\n", stderr.String())
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("hook %q timed out after %v", h.command, h.timeout)
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Exited() {
+			return &exitError{command: h.command, status: status.ExitStatus(), stderr: strings.TrimSpace(stderr.String())}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run hook %q, cause %v", h.command, err)
+	}
+	log.Infoln("Hook finished")
+	return nil
+}
+
+// runProcessGroup runs cmd in a process group of its own. If ctx is done
+// before cmd exits, the whole group is killed, since children of the shell
+// that inherited stdout or stderr would otherwise keep Wait from returning.
+func runProcessGroup(ctx context.Context, cmd *exec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+	return cmd.Wait()
+}
+
+// change describes a source whose mounted files changed.
+type change struct {
+	kind            string
+	gvk             schema.GroupVersionKind
+	namespace       string
+	name            string
+	uid             types.UID
+	resourceVersion string
+	mountPath       string
+	// keys that were added, updated or removed
+	keys []string
+}
+
+// reference returns the source for an Event.
+func (c *change) reference() *apiv1.ObjectReference {
+	return &apiv1.ObjectReference{
+		Kind:            c.gvk.Kind,
+		APIVersion:      c.gvk.GroupVersion().String(),
+		Namespace:       c.namespace,
+		Name:            c.name,
+		UID:             c.uid,
+		ResourceVersion: c.resourceVersion,
+	}
+}
+
+func (c *change) env() []string {
+	return []string{
+		"KLOADER_SOURCE_KIND=" + c.kind,
+		"KLOADER_SOURCE_NAMESPACE=" + c.namespace,
+		"KLOADER_SOURCE_NAME=" + c.name,
+		"KLOADER_RESOURCE_VERSION=" + c.resourceVersion,
+		"KLOADER_MOUNT_PATH=" + c.mountPath,
+		"KLOADER_CHANGED_KEYS=" + strings.Join(c.keys, ","),
+	}
+}
+
+// changeSet collects the changes mounted since the hook last ran, by queue key.
+type changeSet map[string]*change
+
+func (s changeSet) add(key string, c *change) {
+	if old, found := s[key]; found {
+		c.keys = mergeKeys(old.keys, c.keys)
+	}
+	s[key] = c
+}
+
+// env describes the change set to the hook. KLOADER_SOURCES lists every
+// changed source as kind/namespace/name. If a single source changed, it is
+// also described by the KLOADER_SOURCE_* variables.
+func (s changeSet) env() []string {
+	sources := s.sources()
+	if len(sources) == 1 {
+		return append(s[sources[0]].env(), "KLOADER_SOURCES="+sources[0])
+	}
+	var keys []string
+	for _, key := range sources {
+		keys = mergeKeys(keys, s[key].keys)
+	}
+	return []string{
+		"KLOADER_SOURCES=" + strings.Join(sources, " "),
+		"KLOADER_CHANGED_KEYS=" + strings.Join(keys, ","),
+	}
+}
+
+// sources returns the sorted queue keys of the changed sources.
+func (s changeSet) sources() []string {
+	sources := make([]string, 0, len(s))
+	for key := range s {
+		sources = append(sources, key)
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+// changedKeys returns the sorted keys that differ between old and new.
+func changedKeys(old, new map[string][]byte) []string {
+	var keys []string
+	for k, v := range new {
+		if oldV, found := old[k]; !found || !bytes.Equal(oldV, v) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range old {
+		if _, found := new[k]; !found {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func mergeKeys(a, b []string) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, k := range append(append([]string{}, a...), b...) {
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
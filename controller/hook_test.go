@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHookTimeout(t *testing.T) {
+	cases := []struct {
+		name    string
+		command string
+	}{
+		{"shell", "sleep 10"},
+		// the child holds stdout and stderr open after the shell is killed
+		{"child process", "echo hi; sleep 10; echo done"},
+		{"background child", "sleep 10 & wait"},
+	}
+	for _, c := range cases {
+		h := &hook{command: c.command, timeout: 500 * time.Millisecond}
+		start := time.Now()
+		err := h.run(nil)
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: expected the hook to be killed after %v, it ran for %v", c.name, h.timeout, elapsed)
+		}
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Errorf("%s: expected a timeout, found %v", c.name, err)
+		}
+	}
+}
+
+func TestHookRun(t *testing.T) {
+	cases := []struct {
+		name    string
+		command string
+		env     []string
+		err     string
+	}{
+		{name: "success", command: "true"},
+		{name: "environment", command: `test "$KLOADER_SOURCE_NAME" = app`, env: []string{"KLOADER_SOURCE_NAME=app"}},
+		{name: "exit status", command: "echo failed >&2; exit 3", err: `hook "echo failed >&2; exit 3" exited with status 3: failed`},
+	}
+	for _, c := range cases {
+		err := (&hook{command: c.command, timeout: 5 * time.Second}).run(c.env)
+		if c.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		} else if c.err != "" && (err == nil || err.Error() != c.err) {
+			t.Errorf("%s: expected error %q, found %v", c.name, c.err, err)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+type informerKey struct {
+	kind      string
+	namespace string
+	// name is the name of the object, or empty for a selector.
+	name string
+	// selector is the label selector of the objects, or empty for named objects.
+	selector string
+}
+
+// informerFactory hands out one informer per named object, restricted to it
+// by a field selector, so only the watched objects are cached and the service
+// account only needs to list and watch them by name. Every label selector
+// gets an informer of its own.
+type informerFactory struct {
+	resyncPeriod time.Duration
+
+	// sources holds the Source of every watched kind.
+	sources   map[string]Source
+	keys      map[informerKey]bool
+	informers map[informerKey]cache.SharedIndexInformer
+
+	// lock guards informers, running, stopCh and errors. Informers are added
+	// while running, and read by the health and readiness checks.
+	lock    sync.RWMutex
+	running bool
+	// stopCh stops the informers added after start.
+	stopCh <-chan struct{}
+	// errors holds the result of the last list or watch call per informer.
+	errors map[informerKey]error
+}
+
+func newInformerFactory(resyncPeriod time.Duration) *informerFactory {
+	return &informerFactory{
+		resyncPeriod: resyncPeriod,
+		sources:      make(map[string]Source),
+		keys:         make(map[informerKey]bool),
+		informers:    make(map[informerKey]cache.SharedIndexInformer),
+		errors:       make(map[informerKey]error),
+	}
+}
+
+// watch registers interest in the named object. It must be called before start.
+func (f *informerFactory) watch(source Source, namespace, name string) {
+	f.sources[source.Kind()] = source
+	f.keys[informerKey{kind: source.Kind(), namespace: namespace, name: name}] = true
+}
+
+// watchSelector registers interest in every object matching selector. It must
+// be called before start.
+func (f *informerFactory) watchSelector(source Source, namespace, selector string) informerKey {
+	f.sources[source.Kind()] = source
+	key := informerKey{kind: source.Kind(), namespace: namespace, selector: selector}
+	f.keys[key] = true
+	return key
+}
+
+// start creates the informers for every registered object and selector, adds
+// the handler returned by handlerFor to each and runs them until stopCh is closed.
+func (f *informerFactory) start(handlerFor func(key informerKey) cache.ResourceEventHandler, stopCh <-chan struct{}) {
+	for key := range f.keys {
+		informer := cache.NewSharedIndexInformer(f.newListWatch(key), f.sources[key.kind].NewObject(), f.resyncPeriod, cache.Indexers{})
+		informer.AddEventHandler(handlerFor(key))
+		f.lock.Lock()
+		f.informers[key] = informer
+		f.lock.Unlock()
+		go informer.Run(stopCh)
+	}
+
+	f.lock.Lock()
+	f.stopCh = stopCh
+	f.lock.Unlock()
+	f.setRunning(true)
+	go func() {
+		<-stopCh
+		f.setRunning(false)
+	}()
+}
+
+// add watches the named object with handler, for objects that only become
+// known while running, like those read by templates. If the object is
+// watched already, handler is added to its informer. It does nothing unless
+// the factory runs.
+func (f *informerFactory) add(source Source, namespace, name string, handler cache.ResourceEventHandler) {
+	key := informerKey{kind: source.Kind(), namespace: namespace, name: name}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if !f.running {
+		return
+	}
+	if informer, found := f.informers[key]; found {
+		informer.AddEventHandler(handler)
+		return
+	}
+	if _, found := f.sources[key.kind]; !found {
+		f.sources[key.kind] = source
+	}
+	informer := cache.NewSharedIndexInformer(f.newListWatch(key), source.NewObject(), f.resyncPeriod, cache.Indexers{})
+	informer.AddEventHandler(handler)
+	f.informers[key] = informer
+	go informer.Run(f.stopCh)
+}
+
+func (f *informerFactory) setRunning(running bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.running = running
+}
+
+func (f *informerFactory) setError(key informerKey, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.errors[key] = err
+}
+
+// healthy returns an error if the informers are not running or the last
+// attempt of any informer to list or watch failed.
+func (f *informerFactory) healthy() error {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	if !f.running {
+		return fmt.Errorf("informers are not running")
+	}
+	for key, err := range f.errors {
+		if err != nil && key.selector != "" {
+			return fmt.Errorf("failed to watch %ss matching %s in namespace %s, cause %v", key.kind, key.selector, key.namespace, err)
+		} else if err != nil {
+			return fmt.Errorf("failed to watch %s %s/%s, cause %v", key.kind, key.namespace, key.name, err)
+		}
+	}
+	return nil
+}
+
+// hasSynced reports whether every informer has listed its objects once.
+func (f *informerFactory) hasSynced() bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	for _, informer := range f.informers {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// get returns the object from the cache of the informer with key.
+func (f *informerFactory) get(key informerKey, name string) (interface{}, bool, error) {
+	f.lock.RLock()
+	informer, found := f.informers[key]
+	f.lock.RUnlock()
+	if !found {
+		return nil, false, nil
+	}
+	return informer.GetIndexer().GetByKey(key.namespace + "/" + name)
+}
+
+// cached returns the object name from the cache of the informer with key,
+// and whether the informer exists and has synced.
+func (f *informerFactory) cached(key informerKey, name string) (interface{}, bool, bool, error) {
+	f.lock.RLock()
+	informer, found := f.informers[key]
+	f.lock.RUnlock()
+	if !found || !informer.HasSynced() {
+		return nil, false, false, nil
+	}
+	obj, exists, err := informer.GetIndexer().GetByKey(key.namespace + "/" + name)
+	return obj, exists, true, err
+}
+
+func (f *informerFactory) newListWatch(key informerKey) *cache.ListWatch {
+	lw := f.sources[key.kind].ListWatch(key.namespace, func(opts *metav1.ListOptions) {
+		if key.selector != "" {
+			opts.LabelSelector = key.selector
+			return
+		}
+		opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", key.name).String()
+	})
+
+	list, watchFunc := lw.ListFunc, lw.WatchFunc
+	lw.ListFunc = func(opts metav1.ListOptions) (runtime.Object, error) {
+		obj, err := list(opts)
+		f.setError(key, err)
+		return obj, err
+	}
+	lw.WatchFunc = func(opts metav1.ListOptions) (watch.Interface, error) {
+		w, err := watchFunc(opts)
+		f.setError(key, err)
+		return w, err
+	}
+	return lw
+}
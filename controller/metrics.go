@@ -0,0 +1,245 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	metricsNamespace = "kloader"
+
+	reloadSucceeded = "success"
+	reloadFailed    = "failure"
+
+	writeBackSucceeded = "success"
+	writeBackConflict  = "conflict"
+	writeBackFailed    = "failure"
+)
+
+var sourceLabels = []string{"kind", "namespace", "name"}
+
+var (
+	updatesReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "updates_received_total",
+		Help:      "Number of add and update events received for a source.",
+	}, sourceLabels)
+	mountsPerformed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "mounts_total",
+		Help:      "Number of times the mounted files of a source changed.",
+	}, sourceLabels)
+	eventsCoalesced = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "coalesced_events_total",
+		Help:      "Number of events of a source that were merged into a pending mount during the debounce quiet period.",
+	}, sourceLabels)
+	deletesHandled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "deletes_total",
+		Help:      "Number of deleted sources, by the on-delete policy that was applied.",
+	}, append(sourceLabels, "policy"))
+	validationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "validation_failures_total",
+		Help:      "Number of resourceVersions of a source that were rejected by validation.",
+	}, sourceLabels)
+	rollbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rollbacks_total",
+		Help:      "Number of times the mounted files of a source were restored after the boot-cmd failed.",
+	}, sourceLabels)
+	writeBacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "write_backs_total",
+		Help:      "Number of times the local changes to the files of a source were written back, by result.",
+	}, append(sourceLabels, "result"))
+	lastSync = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_sync_timestamp_seconds",
+		Help:      "Unix time of the last successful sync of a source.",
+	}, sourceLabels)
+	projectedVersion = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "source_resource_version",
+		Help:      "Always 1, labeled with the resourceVersion of the source that is currently mounted.",
+	}, append(sourceLabels, "resource_version"))
+	reloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "reloads_total",
+		Help:      "Number of boot-cmd runs, signals and webhook calls, by result.",
+	}, []string{"action", "result"})
+	reloadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "reload_duration_seconds",
+		Help:      "Duration of boot-cmd runs, signals and webhook calls.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"action"})
+
+	workqueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "depth",
+		Help:      "Current number of queued sources.",
+	}, []string{"queue"})
+	workqueueAdds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "adds_total",
+		Help:      "Number of items added to the queue.",
+	}, []string{"queue"})
+	workqueueLatency = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "queue_latency_microseconds",
+		Help:      "How long an item stays in the queue before it is processed.",
+	}, []string{"queue"})
+	workqueueWorkDuration = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "work_duration_microseconds",
+		Help:      "How long processing an item takes.",
+	}, []string{"queue"})
+	workqueueRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "retries_total",
+		Help:      "Number of items that were re-queued after an error.",
+	}, []string{"queue"})
+)
+
+// projectedVersions holds the resourceVersion label of projectedVersion per
+// queue key, so the series of a replaced version can be removed.
+var (
+	projectedVersions     = make(map[string]string)
+	projectedVersionsLock sync.Mutex
+)
+
+// RegisterMetrics registers the metrics of the controller with registry, and
+// exports the metrics of its workqueue through the metrics provider of
+// client-go, which can only be set once per process. It should be called
+// once, before New.
+func RegisterMetrics(registry prometheus.Registerer) error {
+	collectors := []prometheus.Collector{
+		updatesReceived,
+		mountsPerformed,
+		eventsCoalesced,
+		deletesHandled,
+		validationFailures,
+		rollbacks,
+		writeBacks,
+		lastSync,
+		projectedVersion,
+		reloads,
+		reloadDuration,
+		workqueueDepth,
+		workqueueAdds,
+		workqueueLatency,
+		workqueueWorkDuration,
+		workqueueRetries,
+	}
+	for _, collector := range collectors {
+		if err := registry.Register(collector); err != nil {
+			return err
+		}
+	}
+	workqueue.SetProvider(workqueueMetricsProvider{})
+	return nil
+}
+
+func sourceLabelValues(key string) []string {
+	kind, namespace, name := splitQueueKey(key)
+	return []string{kind, namespace, name}
+}
+
+func incUpdateReceivedCounter(key string) {
+	updatesReceived.WithLabelValues(sourceLabelValues(key)...).Inc()
+}
+
+func incMountCounter(kind, namespace, name string) {
+	mountsPerformed.WithLabelValues(kind, namespace, name).Inc()
+}
+
+func incCoalescedCounter(key string) {
+	eventsCoalesced.WithLabelValues(sourceLabelValues(key)...).Inc()
+}
+
+func incDeleteCounter(key string, policy v1alpha1.DeletePolicy) {
+	if policy == "" {
+		policy = v1alpha1.DeletePolicyKeep
+	}
+	deletesHandled.WithLabelValues(append(sourceLabelValues(key), string(policy))...).Inc()
+}
+
+func incValidationFailureCounter(key string) {
+	validationFailures.WithLabelValues(sourceLabelValues(key)...).Inc()
+}
+
+func incRollbackCounter(key string) {
+	rollbacks.WithLabelValues(sourceLabelValues(key)...).Inc()
+}
+
+func incWriteBackCounter(key, result string) {
+	writeBacks.WithLabelValues(append(sourceLabelValues(key), result)...).Inc()
+}
+
+// setSynced records that obj was successfully projected.
+func setSynced(key string, obj interface{}) {
+	lastSync.WithLabelValues(sourceLabelValues(key)...).Set(float64(time.Now().Unix()))
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+	setProjectedVersion(key, accessor.GetResourceVersion())
+}
+
+// setProjectedVersion records resourceVersion as the mounted version of a source.
+func setProjectedVersion(key, resourceVersion string) {
+	projectedVersionsLock.Lock()
+	defer projectedVersionsLock.Unlock()
+	if old, found := projectedVersions[key]; found {
+		projectedVersion.DeleteLabelValues(append(sourceLabelValues(key), old)...)
+	}
+	projectedVersions[key] = resourceVersion
+	projectedVersion.WithLabelValues(append(sourceLabelValues(key), resourceVersion)...).Set(1)
+}
+
+func observeReload(action string, start time.Time, err error) {
+	reloadDuration.WithLabelValues(action).Observe(time.Since(start).Seconds())
+	result := reloadSucceeded
+	if err != nil {
+		result = reloadFailed
+	}
+	reloads.WithLabelValues(action, result).Inc()
+}
+
+// workqueueMetricsProvider exports the metrics of named workqueues. The
+// metrics are shared by every queue of the same name, so that a controller
+// that is replaced on a configuration change keeps reporting into them.
+type workqueueMetricsProvider struct{}
+
+func (workqueueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return workqueueDepth.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return workqueueAdds.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLatencyMetric(name string) workqueue.SummaryMetric {
+	return workqueueLatency.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewWorkDurationMetric(name string) workqueue.SummaryMetric {
+	return workqueueWorkDuration.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return workqueueRetries.WithLabelValues(name)
+}
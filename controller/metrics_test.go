@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRegisterMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	if err := RegisterMetrics(registry); err != nil {
+		t.Fatal(err)
+	}
+	incUpdateReceivedCounter(queueKey(kindConfigMap, "default", "app"))
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, family := range families {
+		if family.GetName() == "kloader_updates_received_total" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected kloader_updates_received_total to be registered")
+	}
+
+	// importing the package registers nothing with the default registry
+	if err := prometheus.DefaultRegisterer.Register(updatesReceived); err != nil {
+		t.Errorf("expected the collectors to be unregistered by default, found %v", err)
+	}
+	prometheus.DefaultRegisterer.Unregister(updatesReceived)
+	if err := RegisterMetrics(registry); err == nil {
+		t.Errorf("expected registering the metrics twice to fail")
+	}
+}
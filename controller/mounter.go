@@ -0,0 +1,275 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+// Mounter projects the data of a single object of a Source into a directory.
+// It is not safe for concurrent use.
+type Mounter struct {
+	client        clientset.Interface
+	source        Source
+	namespace     string
+	name          string
+	mountLocation string
+	spec          v1alpha1.Source
+
+	// current is the generation as of the last mount, and committed the one
+	// the reloaders last succeeded for.
+	current   generation
+	committed *generation
+	// references holds the ConfigMaps and Secrets read by the templates as
+	// of the last mount, and getObject reads them.
+	references map[informerKey]bool
+	getObject  objectGetter
+}
+
+// MounterOption configures a Mounter.
+type MounterOption func(*Mounter)
+
+// WithSpec selects, renders, validates and writes the keys as configured in
+// spec. The directory defaults to spec.MountPath.
+func WithSpec(spec v1alpha1.Source) MounterOption {
+	return func(m *Mounter) {
+		m.spec = spec
+	}
+}
+
+// WithMountPath writes the files into dir, which must exist.
+func WithMountPath(dir string) MounterOption {
+	return func(m *Mounter) {
+		m.mountLocation = dir
+	}
+}
+
+// NewMounter returns a Mounter of the object name of source. If namespace is
+// empty, the namespace of the running pod is used. client is used by
+// templates to read other ConfigMaps and Secrets.
+func NewMounter(client clientset.Interface, source Source, ns, name string, opts ...MounterOption) *Mounter {
+	if ns == "" {
+		ns = namespace()
+	}
+	m := &Mounter{
+		client:    client,
+		source:    source,
+		namespace: ns,
+		name:      name,
+		getObject: fetchObject,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.mountLocation == "" {
+		m.mountLocation = m.spec.MountPath
+	}
+	m.mountLocation = strings.TrimSuffix(m.mountLocation, "/")
+	return m
+}
+
+// Fetch gets the object from the API server.
+func (m *Mounter) Fetch() (runtime.Object, error) {
+	return m.source.Get(m.namespace, m.name)
+}
+
+// Mount projects obj into the mount location. It reports whether any file changed.
+func (m *Mounter) Mount(obj runtime.Object) (bool, error) {
+	change, err := m.mountObject(obj)
+	return change != nil, err
+}
+
+// Clear removes all projected files from the mount location. It reports
+// whether any file was removed.
+func (m *Mounter) Clear() (bool, error) {
+	change, err := m.clear()
+	return change != nil, err
+}
+
+func (m *Mounter) key() string {
+	return queueKey(m.source.Kind(), m.namespace, m.name)
+}
+
+// dataChanged reports whether new must be mounted again: its data changed,
+// or an annotation or label that the source requires did.
+func (m *Mounter) dataChanged(old, new interface{}) bool {
+	oldObj, oldOK := old.(runtime.Object)
+	newObj, newOK := new.(runtime.Object)
+	if !oldOK || !newOK {
+		return false
+	}
+	if m.source.DataChanged(oldObj, newObj) {
+		return true
+	}
+	if m.spec.Require == nil {
+		return false
+	}
+	oldMeta, err := meta.Accessor(oldObj)
+	if err != nil {
+		return false
+	}
+	newMeta, err := meta.Accessor(newObj)
+	if err != nil {
+		return false
+	}
+	return valuesChanged(m.spec.Require.Annotations, oldMeta.GetAnnotations(), newMeta.GetAnnotations()) ||
+		valuesChanged(m.spec.Require.Labels, oldMeta.GetLabels(), newMeta.GetLabels())
+}
+
+// valuesChanged reports whether any of the keys of required has a different
+// value in old and new.
+func valuesChanged(required, old, new map[string]string) bool {
+	for k := range required {
+		oldV, oldFound := old[k]
+		newV, newFound := new[k]
+		if oldFound != newFound || oldV != newV {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Mounter) fetch() (interface{}, error) {
+	return m.Fetch()
+}
+
+// mountError is returned by mountObject if a source could not be turned into
+// files or the files could not be written. reason tells which.
+type mountError struct {
+	reason SyncFailure
+	err    error
+}
+
+func (e *mountError) Error() string {
+	return e.err.Error()
+}
+
+// mountObject projects obj into the mount location. It returns nil if the
+// files on disk did not change.
+func (m *Mounter) mountObject(obj interface{}) (*change, error) {
+	o, ok := obj.(runtime.Object)
+	if !ok {
+		return nil, fmt.Errorf("expected %s, found %T", m.source.GroupVersionKind().Kind, obj)
+	}
+	accessor, err := meta.Accessor(o)
+	if err != nil {
+		return nil, err
+	}
+	data, err := m.source.Data(o)
+	if err != nil {
+		return nil, &mountError{reason: SyncRenderFailed, err: err}
+	}
+
+	if err := checkRequirements(m.spec, accessor.GetAnnotations(), accessor.GetLabels(), data); err != nil {
+		return nil, err
+	}
+	selected, err := selectData(m.spec, data)
+	if _, missing := err.(*missingKeysError); missing {
+		return nil, &mountError{reason: SyncMissingData, err: fmt.Errorf("failed to project %s, cause %v", m, err)}
+	} else if err != nil {
+		return nil, &mountError{reason: SyncRenderFailed, err: fmt.Errorf("failed to project %s, cause %v", m, err)}
+	}
+	refs := make(map[informerKey]bool)
+	selected, err = renderTemplates(m.client, m.getObject, m.namespace, m.spec, data, selected, refs)
+	m.references = refs
+	if err != nil {
+		return nil, &mountError{reason: SyncRenderFailed, err: fmt.Errorf("failed to project %s, cause %v", m, err)}
+	}
+	files, err := aggregateOutput(m.spec, selected)
+	if err != nil {
+		return nil, &mountError{reason: SyncRenderFailed, err: fmt.Errorf("failed to project %s, cause %v", m, err)}
+	}
+	payload := projectPayload(m.spec, files, m.source.DefaultMode())
+	if err := checkPayload(m.spec, m.mountLocation, payload); err != nil {
+		return nil, err
+	}
+	changed, err := writePayload(m.mountLocation, m.source.Kind(), m.namespace, m.name, payload)
+	if err != nil {
+		return nil, &mountError{reason: SyncWriteFailed, err: fmt.Errorf("failed to mount %s, cause %v", m.source.GroupVersionKind().Kind, err)}
+	}
+	log.Infof("Mounted %s into %s\n", m, m.mountLocation)
+
+	keys := changedKeys(m.current.data, selected)
+	m.current = generation{uid: accessor.GetUID(), resourceVersion: accessor.GetResourceVersion(), data: selected, payload: payload}
+	if !changed {
+		return nil, nil
+	}
+	return m.newChange(m.current.uid, m.current.resourceVersion, keys), nil
+}
+
+// clear removes all projected files from the mount location.
+func (m *Mounter) clear() (*change, error) {
+	changed, err := writePayload(m.mountLocation, m.source.Kind(), m.namespace, m.name, nil)
+	if err != nil || !changed {
+		return nil, err
+	}
+	keys := changedKeys(m.current.data, nil)
+	uid := m.current.uid
+	m.current = generation{}
+	return m.newChange(uid, "", keys), nil
+}
+
+// commit marks the mounted files as accepted by the reloaders.
+func (m *Mounter) commit() {
+	committed := m.current
+	m.committed = &committed
+}
+
+// rollback restores the files of the last committed generation. It returns
+// nil if there is nothing to restore.
+func (m *Mounter) rollback() (*change, error) {
+	if m.committed == nil || m.committed.resourceVersion == m.current.resourceVersion {
+		return nil, nil
+	}
+	changed, err := writePayload(m.mountLocation, m.source.Kind(), m.namespace, m.name, m.committed.payload)
+	if err != nil {
+		return nil, err
+	}
+	keys := changedKeys(m.current.data, m.committed.data)
+	m.current = *m.committed
+	if !changed {
+		return nil, nil
+	}
+	return m.newChange(m.current.uid, m.current.resourceVersion, keys), nil
+}
+
+func (m *Mounter) newChange(uid types.UID, resourceVersion string, keys []string) *change {
+	return &change{
+		kind:            m.source.Kind(),
+		gvk:             m.source.GroupVersionKind(),
+		namespace:       m.namespace,
+		name:            m.name,
+		uid:             uid,
+		resourceVersion: resourceVersion,
+		mountPath:       m.mountLocation,
+		keys:            keys,
+	}
+}
+
+// reference returns the object for an Event. obj may be nil if the object is gone.
+func (m *Mounter) reference(obj metav1.Object) *apiv1.ObjectReference {
+	gvk := m.source.GroupVersionKind()
+	ref := &apiv1.ObjectReference{
+		Kind:       gvk.Kind,
+		APIVersion: gvk.GroupVersion().String(),
+		Namespace:  m.namespace,
+		Name:       m.name,
+	}
+	if obj != nil {
+		ref.UID = obj.GetUID()
+		ref.ResourceVersion = obj.GetResourceVersion()
+	}
+	return ref
+}
+
+func (m *Mounter) String() string {
+	return m.source.GroupVersionKind().Kind + " " + m.namespace + "/" + m.name
+}
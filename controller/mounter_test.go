@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMountObjectReason(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kloader-mount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// a regular file cannot contain the mount location
+	blocked := filepath.Join(dir, "blocked")
+	if err := ioutil.WriteFile(blocked, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name      string
+		spec      v1alpha1.Source
+		data      map[string][]byte
+		mountPath string
+		reason    SyncFailure
+	}{
+		{
+			name: "mounted",
+			data: map[string][]byte{"app.conf": []byte("app")},
+		},
+		{
+			name:   "missing item",
+			spec:   v1alpha1.Source{Items: []v1alpha1.KeyToPath{{Key: "app.conf", Path: "app.conf"}}},
+			data:   map[string][]byte{"other.conf": []byte("other")},
+			reason: SyncMissingData,
+		},
+		{
+			name:   "invalid pattern",
+			spec:   v1alpha1.Source{Include: []string{"re:("}},
+			data:   map[string][]byte{"app.conf": []byte("app")},
+			reason: SyncRenderFailed,
+		},
+		{
+			name:   "template fails",
+			spec:   v1alpha1.Source{Template: &v1alpha1.Template{}},
+			data:   map[string][]byte{"app.conf.tmpl": []byte("{{ undefined }}")},
+			reason: SyncRenderFailed,
+		},
+		{
+			name:      "write fails",
+			data:      map[string][]byte{"app.conf": []byte("app")},
+			mountPath: filepath.Join(blocked, "mnt"),
+			reason:    SyncWriteFailed,
+		},
+	}
+	for _, c := range cases {
+		mountPath := c.mountPath
+		if mountPath == "" {
+			mountPath = filepath.Join(dir, c.name)
+			if err := os.Mkdir(mountPath, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		m := NewMounter(nil, NewSecretSource(nil), "default", "app", WithSpec(c.spec), WithMountPath(mountPath))
+		secret := &apiv1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+			Data:       c.data,
+		}
+		_, err := m.mountObject(secret)
+		if c.reason == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", c.name, err)
+			}
+			continue
+		}
+		mountErr, ok := err.(*mountError)
+		if !ok {
+			t.Errorf("%s: expected a mount error, found %v", c.name, err)
+			continue
+		}
+		if mountErr.reason != c.reason {
+			t.Errorf("%s: expected reason %s, found %s: %v", c.name, c.reason, mountErr.reason, err)
+		}
+	}
+}
+
+func TestDataChanged(t *testing.T) {
+	secret := func(annotations, labels map[string]string, data string) *apiv1.Secret {
+		return &apiv1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", Annotations: annotations, Labels: labels},
+			Data:       map[string][]byte{"app.conf": []byte(data)},
+		}
+	}
+	require := &v1alpha1.Requirements{
+		Annotations: map[string]string{"ready": "true"},
+		Labels:      map[string]string{"tier": "web"},
+	}
+	cases := []struct {
+		name    string
+		require *v1alpha1.Requirements
+		old     *apiv1.Secret
+		new     *apiv1.Secret
+		changed bool
+	}{
+		{
+			name:    "data",
+			old:     secret(nil, nil, "a"),
+			new:     secret(nil, nil, "b"),
+			changed: true,
+		},
+		{
+			name: "annotation without requirements",
+			old:  secret(nil, nil, "a"),
+			new:  secret(map[string]string{"ready": "true"}, nil, "a"),
+		},
+		{
+			name:    "required annotation added",
+			require: require,
+			old:     secret(nil, nil, "a"),
+			new:     secret(map[string]string{"ready": "true"}, nil, "a"),
+			changed: true,
+		},
+		{
+			name:    "required label changed",
+			require: require,
+			old:     secret(nil, map[string]string{"tier": "db"}, "a"),
+			new:     secret(nil, map[string]string{"tier": "web"}, "a"),
+			changed: true,
+		},
+		{
+			name:    "required annotation removed",
+			require: require,
+			old:     secret(map[string]string{"ready": "true"}, nil, "a"),
+			new:     secret(nil, nil, "a"),
+			changed: true,
+		},
+		{
+			name:    "other annotation",
+			require: require,
+			old:     secret(nil, nil, "a"),
+			new:     secret(map[string]string{"owner": "ops"}, nil, "a"),
+		},
+	}
+	for _, c := range cases {
+		m := NewMounter(nil, NewSecretSource(nil), "default", "app", WithSpec(v1alpha1.Source{Require: c.require}))
+		if changed := m.dataChanged(c.old, c.new); changed != c.changed {
+			t.Errorf("%s: expected changed %v, found %v", c.name, c.changed, changed)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+	"github.com/ghodss/yaml"
+)
+
+var (
+	envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	envInvalid    = regexp.MustCompile(`[^A-Z0-9_]`)
+	tomlBareKey   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+var defaultOutputFiles = map[v1alpha1.OutputFormat]string{
+	v1alpha1.OutputFormatDotenv:     ".env",
+	v1alpha1.OutputFormatJSON:       "config.json",
+	v1alpha1.OutputFormatYAML:       "config.yaml",
+	v1alpha1.OutputFormatProperties: "application.properties",
+	v1alpha1.OutputFormatTOML:       "config.toml",
+}
+
+// aggregateOutput returns the single file that holds the selected keys in the
+// output format of spec. Without an output, selected is returned as is.
+func aggregateOutput(spec v1alpha1.Source, selected map[string][]byte) (map[string][]byte, error) {
+	out := spec.Output
+	if out == nil {
+		return selected, nil
+	}
+
+	values := make(map[string]string)
+	origin := make(map[string]string)
+	for k, v := range selected {
+		name := out.KeyPrefix + transformKey(out.KeyTransform, k)
+		if other, found := origin[name]; found {
+			return nil, fmt.Errorf("keys %s and %s are both written as %s", other, k, name)
+		}
+		origin[name] = k
+		values[name] = string(v)
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	switch out.Format {
+	case v1alpha1.OutputFormatDotenv:
+		data, err = formatDotenv(values)
+	case v1alpha1.OutputFormatJSON:
+		if data, err = json.MarshalIndent(values, "", "  "); err == nil {
+			data = append(data, '\n')
+		}
+	case v1alpha1.OutputFormatYAML:
+		data, err = yaml.Marshal(values)
+	case v1alpha1.OutputFormatProperties:
+		data = formatProperties(values)
+	case v1alpha1.OutputFormatTOML:
+		data = formatTOML(values)
+	default:
+		err = fmt.Errorf("unknown output format %q", out.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file := out.File
+	if file == "" {
+		file = defaultOutputFiles[out.Format]
+	}
+	return map[string][]byte{file: data}, nil
+}
+
+func transformKey(transform v1alpha1.KeyTransform, key string) string {
+	switch transform {
+	case v1alpha1.KeyTransformUpper:
+		return strings.ToUpper(key)
+	case v1alpha1.KeyTransformLower:
+		return strings.ToLower(key)
+	case v1alpha1.KeyTransformEnv:
+		name := envInvalid.ReplaceAllString(strings.ToUpper(key), "_")
+		if name == "" || (name[0] >= '0' && name[0] <= '9') {
+			name = "_" + name
+		}
+		return name
+	}
+	return key
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatDotenv writes NAME="value" lines. Values are double quoted, with
+// backslashes, quotes, dollar signs and line breaks escaped.
+func formatDotenv(values map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`, "\r", `\r`)
+	for _, k := range sortedKeys(values) {
+		if !envNameRegexp.MatchString(k) {
+			return nil, fmt.Errorf("%s is not a valid environment variable name, use the env key transform", k)
+		}
+		fmt.Fprintf(&buf, "%s=\"%s\"\n", k, replacer.Replace(values[k]))
+	}
+	return buf.Bytes(), nil
+}
+
+// formatProperties writes key=value lines, escaped as java.util.Properties
+// reads them from an ISO 8859-1 encoded file.
+func formatProperties(values map[string]string) []byte {
+	var buf bytes.Buffer
+	for _, k := range sortedKeys(values) {
+		buf.WriteString(escapeProperty(k, true))
+		buf.WriteByte('=')
+		buf.WriteString(escapeProperty(values[k], false))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func escapeProperty(s string, isKey bool) string {
+	var buf bytes.Buffer
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			buf.WriteString(`\\`)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == '\f':
+			buf.WriteString(`\f`)
+		case r == ' ' && (isKey || i == 0):
+			buf.WriteString(`\ `)
+		case isKey && (r == '=' || r == ':' || r == '#' || r == '!'):
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			writeUnicodeEscape(&buf, r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+// formatTOML writes key = "value" lines. Keys that are not bare keys are
+// quoted, so a dot in a key does not create a table.
+func formatTOML(values map[string]string) []byte {
+	var buf bytes.Buffer
+	for _, k := range sortedKeys(values) {
+		if tomlBareKey.MatchString(k) {
+			buf.WriteString(k)
+		} else {
+			buf.WriteString(tomlString(k))
+		}
+		buf.WriteString(" = ")
+		buf.WriteString(tomlString(values[k]))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// tomlString returns s as a TOML basic string.
+func tomlString(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\r':
+			buf.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f || r == utf8.RuneError {
+				writeUnicodeEscape(&buf, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// writeUnicodeEscape writes r as \uXXXX, or as a UTF-16 surrogate pair if it
+// is outside the basic multilingual plane.
+func writeUnicodeEscape(buf *bytes.Buffer, r rune) {
+	if r > 0xffff {
+		r -= 0x10000
+		writeUnicodeEscape(buf, 0xd800+(r>>10))
+		writeUnicodeEscape(buf, 0xdc00+(r&0x3ff))
+		return
+	}
+	s := strconv.FormatInt(int64(r), 16)
+	buf.WriteString(`\u` + strings.Repeat("0", 4-len(s)) + s)
+}
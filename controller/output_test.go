@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+	"github.com/ghodss/yaml"
+)
+
+func TestAggregateOutput(t *testing.T) {
+	cases := []struct {
+		name   string
+		output v1alpha1.Output
+		data   map[string]string
+		file   string
+		// content is the expected file, if set
+		content string
+		err     string
+	}{
+		{
+			name:   "dotenv escapes quotes, dollar signs, backslashes and line breaks",
+			output: v1alpha1.Output{Format: v1alpha1.OutputFormatDotenv},
+			data: map[string]string{
+				"MSG":  "say \"hi\" to $USER\\n",
+				"TEXT": "first\r\nsecond",
+			},
+			file:    ".env",
+			content: "MSG=\"say \\\"hi\\\" to \\$USER\\\\n\"\nTEXT=\"first\\r\\nsecond\"\n",
+		},
+		{
+			name:   "dotenv rejects invalid names",
+			output: v1alpha1.Output{Format: v1alpha1.OutputFormatDotenv},
+			data:   map[string]string{"db.host": "localhost"},
+			err:    "db.host is not a valid environment variable name",
+		},
+		{
+			name:    "dotenv with the env key transform",
+			output:  v1alpha1.Output{Format: v1alpha1.OutputFormatDotenv, KeyTransform: v1alpha1.KeyTransformEnv, KeyPrefix: "APP_"},
+			data:    map[string]string{"db.host": "localhost", "1st-key": "x"},
+			file:    ".env",
+			content: "APP_DB_HOST=\"localhost\"\nAPP__1ST_KEY=\"x\"\n",
+		},
+		{
+			name:   "transformed keys collide",
+			output: v1alpha1.Output{Format: v1alpha1.OutputFormatDotenv, KeyTransform: v1alpha1.KeyTransformEnv},
+			data:   map[string]string{"a-b": "1", "a_b": "2"},
+			err:    "are both written as A_B",
+		},
+		{
+			name:   "properties escapes keys, leading spaces and non-ASCII",
+			output: v1alpha1.Output{Format: v1alpha1.OutputFormatProperties},
+			data: map[string]string{
+				"a b=c:d#e!f": " x = y",
+				"path":        "C:\\tmp\tdir\n",
+				"unicode":     "caf\u00e9 \U0001F600",
+			},
+			file: "application.properties",
+			content: "a\\ b\\=c\\:d\\#e\\!f=\\ x = y\n" +
+				"path=C:\\\\tmp\\tdir\\n\n" +
+				"unicode=caf\\u00e9 \\ud83d\\ude00\n",
+		},
+		{
+			name:   "toml quotes keys that are not bare and escapes control characters",
+			output: v1alpha1.Output{Format: v1alpha1.OutputFormatTOML},
+			data: map[string]string{
+				"db.host": "localhost",
+				"port":    "8080",
+				"quote":   "say \"hi\"\\\n\x01\x7f",
+			},
+			file:    "config.toml",
+			content: "\"db.host\" = \"localhost\"\nport = \"8080\"\nquote = \"say \\\"hi\\\"\\\\\\n\\u0001\\u007f\"\n",
+		},
+		{
+			name:   "json",
+			output: v1alpha1.Output{Format: v1alpha1.OutputFormatJSON, File: "app.json"},
+			data:   map[string]string{"quote": "say \"hi\"", "html": "<a href=\"x\">&</a>", "lines": "a\nb"},
+			file:   "app.json",
+		},
+		{
+			name:   "yaml",
+			output: v1alpha1.Output{Format: v1alpha1.OutputFormatYAML},
+			data:   map[string]string{"colon": "a: b", "lines": "a\nb\n", "number": "0123", "bool": "yes", "comment": "# not"},
+			file:   "config.yaml",
+		},
+	}
+	for _, c := range cases {
+		selected := make(map[string][]byte)
+		for k, v := range c.data {
+			selected[k] = []byte(v)
+		}
+		files, err := aggregateOutput(v1alpha1.Source{Output: &c.output}, selected)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected error %q, found %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+			continue
+		}
+		content, found := files[c.file]
+		if !found || len(files) != 1 {
+			t.Errorf("%s: expected only the file %s, found %v", c.name, c.file, files)
+			continue
+		}
+		if c.content != "" && string(content) != c.content {
+			t.Errorf("%s: expected\n%s\nfound\n%s", c.name, c.content, content)
+		}
+
+		// the formats with a decoder must read back the same values
+		var decoded map[string]string
+		switch c.output.Format {
+		case v1alpha1.OutputFormatJSON:
+			err = json.Unmarshal(content, &decoded)
+		case v1alpha1.OutputFormatYAML:
+			err = yaml.Unmarshal(content, &decoded)
+		default:
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: failed to decode the file, cause %v", c.name, err)
+		} else if !reflect.DeepEqual(decoded, c.data) {
+			t.Errorf("%s: expected %v, decoded %v", c.name, c.data, decoded)
+		}
+	}
+}
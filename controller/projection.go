@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+)
+
+// keySelector decides which keys of a source are projected.
+type keySelector struct {
+	include, exclude []func(key string) bool
+}
+
+func newKeySelector(spec v1alpha1.Source) (*keySelector, error) {
+	include, err := newMatchers(spec.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := newMatchers(spec.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	return &keySelector{include: include, exclude: exclude}, nil
+}
+
+func (s *keySelector) selected(key string) bool {
+	for _, match := range s.exclude {
+		if match(key) {
+			return false
+		}
+	}
+	if len(s.include) == 0 {
+		return true
+	}
+	for _, match := range s.include {
+		if match(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func newMatchers(patterns []string) ([]func(key string) bool, error) {
+	matchers := make([]func(key string) bool, 0, len(patterns))
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, v1alpha1.RegexpPrefix) {
+			re, err := regexp.Compile(strings.TrimPrefix(pattern, v1alpha1.RegexpPrefix))
+			if err != nil {
+				return nil, err
+			}
+			matchers = append(matchers, re.MatchString)
+		} else {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, err
+			}
+			pattern := pattern
+			matchers = append(matchers, func(key string) bool {
+				matched, _ := path.Match(pattern, key)
+				return matched
+			})
+		}
+	}
+	return matchers, nil
+}
+
+// missingKeysError is returned by selectData if keys listed in the items of
+// a source do not exist.
+type missingKeysError struct {
+	keys []string
+}
+
+func (e *missingKeysError) Error() string {
+	return fmt.Sprintf("keys %s not found", strings.Join(e.keys, ", "))
+}
+
+// selectData returns the keys of data that are projected according to spec.
+func selectData(spec v1alpha1.Source, data map[string][]byte) (map[string][]byte, error) {
+	selector, err := newKeySelector(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string][]byte)
+	if len(spec.Items) == 0 {
+		for k, v := range data {
+			if selector.selected(k) {
+				selected[k] = v
+			}
+		}
+		return selected, nil
+	}
+
+	var missing []string
+	for _, item := range spec.Items {
+		if !selector.selected(item.Key) {
+			continue
+		}
+		v, found := data[item.Key]
+		if !found {
+			missing = append(missing, item.Key)
+			continue
+		}
+		selected[item.Key] = v
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, &missingKeysError{keys: missing}
+	}
+	return selected, nil
+}
+
+// projectPayload maps the selected keys, or the file aggregated from them, to
+// the files written into the mount location.
+func projectPayload(spec v1alpha1.Source, selected map[string][]byte, defaultMode int32) map[string]FileProjection {
+	payload := make(map[string]FileProjection)
+	// the file of an output is not a key, so it is never mapped by Items
+	if len(spec.Items) == 0 || spec.Output != nil {
+		for k, v := range selected {
+			payload[k] = projectFile(spec, k, v, defaultMode)
+		}
+		return payload
+	}
+
+	for _, item := range spec.Items {
+		v, found := selected[item.Key]
+		if !found {
+			continue
+		}
+		file := projectFile(spec, item.Key, v, defaultMode)
+		if item.Mode != nil {
+			file.Mode = *item.Mode
+		}
+		payload[item.Path] = file
+	}
+	return payload
+}
+
+// projectFile returns the projection of key with the mode and ownership
+// configured in spec.
+func projectFile(spec v1alpha1.Source, key string, data []byte, defaultMode int32) FileProjection {
+	mode := defaultMode
+	if spec.DefaultMode != nil {
+		mode = *spec.DefaultMode
+	}
+	if keyMode, found := spec.Modes[key]; found {
+		mode = keyMode
+	}
+	return FileProjection{Data: data, Mode: mode, UID: spec.UID, GID: spec.GID}
+}
+
+// requirementsError is returned while a source does not meet its Requirements.
+type requirementsError struct {
+	missing []string
+}
+
+func (e *requirementsError) Error() string {
+	return "missing " + strings.Join(e.missing, ", ")
+}
+
+// checkRequirements returns a *requirementsError if data or the annotations
+// and labels of the source do not meet the requirements of spec.
+func checkRequirements(spec v1alpha1.Source, annotations, labels map[string]string, data map[string][]byte) error {
+	if spec.Require == nil {
+		return nil
+	}
+	var missing []string
+	for _, key := range spec.Require.Keys {
+		if _, found := data[key]; !found {
+			missing = append(missing, "key "+key)
+		}
+	}
+	for k, v := range spec.Require.Annotations {
+		if value, found := annotations[k]; !found || value != v {
+			missing = append(missing, "annotation "+k+"="+v)
+		}
+	}
+	for k, v := range spec.Require.Labels {
+		if value, found := labels[k]; !found || value != v {
+			missing = append(missing, "label "+k+"="+v)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return &requirementsError{missing: missing}
+}
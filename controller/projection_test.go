@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+)
+
+func TestSelectData(t *testing.T) {
+	data := map[string][]byte{
+		"app.conf":     []byte("app"),
+		"test-a.conf":  []byte("test"),
+		"nginx.conf":   []byte("nginx"),
+		"README":       []byte("readme"),
+		"tls.crt":      []byte("crt"),
+		"tls.key":      []byte("key"),
+		"override.ini": []byte("ini"),
+	}
+	cases := []struct {
+		name     string
+		spec     v1alpha1.Source
+		selected []string
+		err      string
+	}{
+		{
+			name:     "everything",
+			selected: []string{"app.conf", "test-a.conf", "nginx.conf", "README", "tls.crt", "tls.key", "override.ini"},
+		},
+		{
+			name:     "include glob",
+			spec:     v1alpha1.Source{Include: []string{"*.conf"}},
+			selected: []string{"app.conf", "test-a.conf", "nginx.conf"},
+		},
+		{
+			name:     "exclude regexp wins over include",
+			spec:     v1alpha1.Source{Include: []string{"*.conf"}, Exclude: []string{"re:^test-.*"}},
+			selected: []string{"app.conf", "nginx.conf"},
+		},
+		{
+			name:     "exclude only",
+			spec:     v1alpha1.Source{Exclude: []string{"tls.*", "*.conf"}},
+			selected: []string{"README", "override.ini"},
+		},
+		{
+			name:     "items",
+			spec:     v1alpha1.Source{Items: []v1alpha1.KeyToPath{{Key: "tls.crt", Path: "certs/server.pem"}}},
+			selected: []string{"tls.crt"},
+		},
+		{
+			name:     "items filtered by exclude",
+			spec:     v1alpha1.Source{Items: []v1alpha1.KeyToPath{{Key: "tls.crt", Path: "a"}, {Key: "tls.key", Path: "b"}}, Exclude: []string{"*.key"}},
+			selected: []string{"tls.crt"},
+		},
+		{
+			name: "missing items",
+			spec: v1alpha1.Source{Items: []v1alpha1.KeyToPath{{Key: "tls.crt", Path: "a"}, {Key: "z", Path: "z"}, {Key: "ca.crt", Path: "c"}}},
+			err:  "keys ca.crt, z not found",
+		},
+		{
+			name: "invalid pattern",
+			spec: v1alpha1.Source{Include: []string{"re:("}},
+			err:  "error parsing regexp: missing closing ): `(`",
+		},
+	}
+	for _, c := range cases {
+		selected, err := selectData(c.spec, data)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("%s: expected error %q, found %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+			continue
+		}
+		expected := make(map[string][]byte)
+		for _, k := range c.selected {
+			expected[k] = data[k]
+		}
+		if !reflect.DeepEqual(selected, expected) {
+			t.Errorf("%s: expected %q, found %q", c.name, expected, selected)
+		}
+	}
+}
+
+func TestProjectPayload(t *testing.T) {
+	mode := func(m int32) *int32 { return &m }
+	uid := int64(101)
+	selected := map[string][]byte{"tls.crt": []byte("crt"), "tls.key": []byte("key")}
+	cases := []struct {
+		name    string
+		spec    v1alpha1.Source
+		payload map[string]FileProjection
+	}{
+		{
+			name: "default mode of the source",
+			payload: map[string]FileProjection{
+				"tls.crt": {Data: []byte("crt"), Mode: 0400},
+				"tls.key": {Data: []byte("key"), Mode: 0400},
+			},
+		},
+		{
+			name: "default and per-key modes with owner",
+			spec: v1alpha1.Source{DefaultMode: mode(0440), Modes: map[string]int32{"tls.crt": 0444}, UID: &uid},
+			payload: map[string]FileProjection{
+				"tls.crt": {Data: []byte("crt"), Mode: 0444, UID: &uid},
+				"tls.key": {Data: []byte("key"), Mode: 0440, UID: &uid},
+			},
+		},
+		{
+			name: "items with paths and modes",
+			spec: v1alpha1.Source{
+				Modes: map[string]int32{"tls.key": 0440},
+				Items: []v1alpha1.KeyToPath{
+					{Key: "tls.crt", Path: "certs/server.pem", Mode: mode(0444)},
+					{Key: "tls.key", Path: "certs/server.key"},
+				},
+			},
+			payload: map[string]FileProjection{
+				"certs/server.pem": {Data: []byte("crt"), Mode: 0444},
+				"certs/server.key": {Data: []byte("key"), Mode: 0440},
+			},
+		},
+	}
+	for _, c := range cases {
+		if payload := projectPayload(c.spec, selected, secretDefaultMode); !reflect.DeepEqual(payload, c.payload) {
+			t.Errorf("%s: expected %+v, found %+v", c.name, c.payload, payload)
+		}
+	}
+}
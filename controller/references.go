@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/appscode/go/log"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+)
+
+// watchReferences mounts the source with queue key again whenever one of the
+// ConfigMaps and Secrets in refs, which its templates read, changes. Objects
+// that are no longer read keep their informer, but no longer requeue the source.
+func (c *Controller) watchReferences(key string, refs map[informerKey]bool) {
+	var added []informerKey
+	c.lock.Lock()
+	for ref, dependents := range c.dependents {
+		if !refs[ref] {
+			dependents.Delete(key)
+		}
+	}
+	for ref := range refs {
+		if _, found := c.dependents[ref]; !found {
+			c.dependents[ref] = sets.NewString()
+			added = append(added, ref)
+		}
+		c.dependents[ref].Insert(key)
+	}
+	c.lock.Unlock()
+
+	for _, ref := range added {
+		if source := c.referenceSource(ref); source != nil {
+			c.informers.add(source, ref.namespace, ref.name, c.referenceHandler(source, ref))
+		}
+	}
+}
+
+// referenceSource returns the Source of an object read by a template, or nil
+// if templates cannot read objects of its kind.
+func (c *Controller) referenceSource(ref informerKey) Source {
+	switch ref.kind {
+	case kindConfigMap:
+		return NewConfigMapSource(c.KubeClient)
+	case kindSecret:
+		return NewSecretSource(c.KubeClient)
+	}
+	return nil
+}
+
+// cachedObject returns the object read by a template from the cache of its
+// informer, which watchReferences starts after the first mount. Until the
+// informer has synced, the object is fetched from the API server.
+func (c *Controller) cachedObject(source Source, namespace, name string) (runtime.Object, error) {
+	key := informerKey{kind: source.Kind(), namespace: namespace, name: name}
+	obj, exists, synced, err := c.informers.cached(key, name)
+	switch {
+	case err != nil:
+		return nil, err
+	case !synced:
+		return source.Get(namespace, name)
+	case !exists:
+		return nil, fmt.Errorf("%s %s/%s not found", source.GroupVersionKind().Kind, namespace, name)
+	}
+	o, ok := obj.(runtime.Object)
+	if !ok {
+		return nil, fmt.Errorf("expected %s, found %T", source.GroupVersionKind().Kind, obj)
+	}
+	return o, nil
+}
+
+// referenceHandler queues the sources whose templates read the object of ref
+// when it is created, deleted or its data changes.
+func (c *Controller) referenceHandler(source Source, ref informerKey) cache.ResourceEventHandler {
+	requeue := func() {
+		c.lock.RLock()
+		keys := c.dependents[ref].List()
+		c.lock.RUnlock()
+		for _, key := range keys {
+			log.Infof("Queued %s, %s %s/%s read by its templates changed\n", key, ref.kind, ref.namespace, ref.name)
+			c.debouncer.enqueue(key)
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			requeue()
+		},
+		UpdateFunc: func(old, new interface{}) {
+			oldObj, oldOK := old.(runtime.Object)
+			newObj, newOK := new.(runtime.Object)
+			if oldOK && newOK && source.DataChanged(oldObj, newObj) {
+				requeue()
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			requeue()
+		},
+	}
+}
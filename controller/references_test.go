@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestCachedObject(t *testing.T) {
+	ctrl := newTestController(Config{})
+	source := NewConfigMapSource(ctrl.KubeClient)
+	cm := configMap{
+		ConfigMap: apiv1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "common", ResourceVersion: "1"},
+			Data:       map[string]string{"domain": "example.com"},
+		},
+	}
+	lw := &cache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			return &configMapList{ListMeta: metav1.ListMeta{ResourceVersion: "1"}, Items: []configMap{cm}}, nil
+		},
+		WatchFunc: func(metav1.ListOptions) (watch.Interface, error) {
+			return watch.NewFake(), nil
+		},
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	for _, name := range []string{"common", "missing"} {
+		informer := cache.NewSharedIndexInformer(lw, source.NewObject(), 0, cache.Indexers{})
+		ctrl.informers.informers[informerKey{kind: kindConfigMap, namespace: "default", name: name}] = informer
+		go informer.Run(stopCh)
+		if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+			t.Fatal("informer did not sync")
+		}
+	}
+
+	cases := []struct {
+		name string
+		err  string
+	}{
+		// the API server of the test controller is unreachable, so only
+		// cached objects can be read
+		{name: "common"},
+		{name: "missing", err: "ConfigMap default/missing not found"},
+		{name: "unwatched", err: "connection refused"},
+	}
+	for _, c := range cases {
+		obj, err := ctrl.cachedObject(source, "default", c.name)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected error %q, found %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+			continue
+		}
+		data, err := source.Data(obj)
+		if err != nil || string(data["domain"]) != "example.com" {
+			t.Errorf("%s: expected the cached data, found %v: %v", c.name, data, err)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+const resourceDefaultMode int32 = 0644
+
+// NewResourceSource projects fields of the objects of any namespaced
+// resource, like a custom resource. The objects are read as unstructured
+// JSON by the dynamic client, so the types of the resource need not be known.
+func NewResourceSource(kubeConfig *rest.Config, resource schema.GroupVersionResource, fields []v1alpha1.FieldToKey) (Source, error) {
+	for _, f := range fields {
+		if _, err := v1alpha1.ParseJSONPath(f.JSONPath); err != nil {
+			return nil, err
+		}
+	}
+
+	config := *kubeConfig
+	gv := resource.GroupVersion()
+	config.GroupVersion = &gv
+	config.APIPath = "/apis"
+	if gv.Group == "" {
+		config.APIPath = "/api"
+	}
+	client, err := dynamic.NewClient(&config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for %s, cause %v", resource, err)
+	}
+	disc, err := discovery.NewDiscoveryClientForConfig(kubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery client, cause %v", err)
+	}
+	return &resourceSource{
+		resource:  resource,
+		fields:    fields,
+		client:    client,
+		discovery: disc,
+	}, nil
+}
+
+type resourceSource struct {
+	resource  schema.GroupVersionResource
+	fields    []v1alpha1.FieldToKey
+	client    dynamic.Interface
+	discovery discovery.DiscoveryInterface
+
+	kindOnce sync.Once
+	kind     string
+}
+
+// Kind is the resource, version and group, like ingresses.v1beta1.extensions.
+// The version is included, so that a resource watched in two versions gets
+// an informer and queue keys per version.
+func (s *resourceSource) Kind() string {
+	if s.resource.Group == "" {
+		return s.resource.Resource + "." + s.resource.Version
+	}
+	return s.resource.Resource + "." + s.resource.Version + "." + s.resource.Group
+}
+
+// GroupVersionKind looks up the kind of the resource once. It falls back to
+// the resource name if the API server cannot be asked.
+func (s *resourceSource) GroupVersionKind() schema.GroupVersionKind {
+	s.kindOnce.Do(func() {
+		s.kind = s.resource.Resource
+		list, err := s.discovery.ServerResourcesForGroupVersion(s.resource.GroupVersion().String())
+		if err != nil {
+			log.Errorf("Failed to find the kind of %s, cause %v\n", s.Kind(), err)
+			return
+		}
+		for _, r := range list.APIResources {
+			if r.Name == s.resource.Resource {
+				s.kind = r.Kind
+				return
+			}
+		}
+	})
+	return s.resource.GroupVersion().WithKind(s.kind)
+}
+
+func (s *resourceSource) DefaultMode() int32 { return resourceDefaultMode }
+
+func (s *resourceSource) NewObject() runtime.Object { return &unstructured.Unstructured{} }
+
+// resourceClient returns the client of the resource in namespace.
+func (s *resourceSource) resourceClient(namespace string) dynamic.ResourceInterface {
+	return s.client.Resource(&metav1.APIResource{Name: s.resource.Resource, Namespaced: true}, namespace)
+}
+
+func (s *resourceSource) ListWatch(namespace string, tweak func(*metav1.ListOptions)) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			tweak(&opts)
+			return s.resourceClient(namespace).List(opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			tweak(&opts)
+			return s.resourceClient(namespace).Watch(opts)
+		},
+	}
+}
+
+func (s *resourceSource) Get(namespace, name string) (runtime.Object, error) {
+	return s.resourceClient(namespace).Get(name, metav1.GetOptions{})
+}
+
+// Data returns the value of every field found in obj. A string is returned
+// as is, any other value encoded as JSON. A JSONPath that selects several
+// values, like {.spec.ports[*].port}, results in a JSON array.
+func (s *resourceSource) Data(obj runtime.Object) (map[string][]byte, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("expected unstructured object, found %T", obj)
+	}
+	data := make(map[string][]byte)
+	for _, f := range s.fields {
+		// a JSONPath keeps state while it is evaluated, so it is parsed for
+		// every object instead of being shared
+		path, err := v1alpha1.ParseJSONPath(f.JSONPath)
+		if err != nil {
+			return nil, err
+		}
+		results, err := path.FindResults(u.Object)
+		if err != nil {
+			// like a missing field, an index out of range or a value of
+			// another type selects nothing
+			continue
+		}
+		var values []interface{}
+		for _, result := range results {
+			for _, v := range result {
+				values = append(values, v.Interface())
+			}
+		}
+		var v interface{} = values
+		switch len(values) {
+		case 0:
+			continue
+		case 1:
+			v = values[0]
+		}
+		if str, ok := v.(string); ok {
+			data[f.Key] = []byte(str)
+			continue
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s of %s %s/%s, cause %v", f.JSONPath, s.Kind(), u.GetNamespace(), u.GetName(), err)
+		}
+		data[f.Key] = value
+	}
+	return data, nil
+}
+
+func (s *resourceSource) DataChanged(old, new runtime.Object) bool {
+	oldData, oldErr := s.Data(old)
+	newData, newErr := s.Data(new)
+	return oldErr != nil || newErr != nil || !reflect.DeepEqual(oldData, newData)
+}
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+func TestResourceData(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Gateway",
+		"metadata": map[string]interface{}{
+			"namespace":   "default",
+			"name":        "public",
+			"annotations": map[string]interface{}{"example.com/routes": "/ -> web"},
+		},
+		"spec": map[string]interface{}{
+			"listeners": []interface{}{
+				map[string]interface{}{"port": int64(80)},
+				map[string]interface{}{"port": int64(443)},
+			},
+		},
+	}}
+	s := &resourceSource{fields: []v1alpha1.FieldToKey{
+		{JSONPath: `{.metadata.annotations.example\.com/routes}`, Key: "routes"},
+		{JSONPath: "{.spec.listeners[0]}", Key: "first.json"},
+		{JSONPath: ".spec.listeners[*].port", Key: "ports.json"},
+		{JSONPath: "{.spec.missing}", Key: "missing"},
+		{JSONPath: "{.spec.listeners[5].port}", Key: "out-of-range"},
+	}}
+	data, err := s.Data(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]byte{
+		"routes":     []byte("/ -> web"),
+		"first.json": []byte(`{"port":80}`),
+		"ports.json": []byte(`[80,443]`),
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("expected %q, found %q", expected, data)
+	}
+}
+
+func TestResourceKind(t *testing.T) {
+	cases := []struct {
+		resource schema.GroupVersionResource
+		kind     string
+	}{
+		{resource: schema.GroupVersionResource{Version: "v1", Resource: "services"}, kind: "services.v1"},
+		{resource: schema.GroupVersionResource{Group: "extensions", Version: "v1beta1", Resource: "ingresses"}, kind: "ingresses.v1beta1.extensions"},
+		{resource: schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}, kind: "ingresses.v1.networking.k8s.io"},
+	}
+	for _, c := range cases {
+		s := &resourceSource{resource: c.resource}
+		if kind := s.Kind(); kind != c.kind {
+			t.Errorf("%s: expected kind %s, found %s", c.resource, c.kind, kind)
+		}
+	}
+
+	// the same object in two versions is watched and queued twice
+	ctrl := New(&rest.Config{Host: "http://127.0.0.1:1"}, Config{})
+	for i, version := range []string{"v1", "v2"} {
+		source := &resourceSource{resource: schema.GroupVersionResource{Group: "example.com", Version: version, Resource: "gateways"}}
+		if err := ctrl.AddMounter(NewMounter(nil, source, "default", "public", WithSpec(v1alpha1.Source{MountPath: fmt.Sprintf("/etc/gateway-%d", i)}))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(ctrl.mounters) != 2 || len(ctrl.informers.keys) != 2 {
+		t.Errorf("expected 2 mounters and informers, found %d and %d", len(ctrl.mounters), len(ctrl.informers.keys))
+	}
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/appscode/go/log"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// generation is the set of files projected from one resourceVersion of a source.
+type generation struct {
+	uid             types.UID
+	resourceVersion string
+	// data holds the selected keys the files were projected from.
+	data    map[string][]byte
+	payload map[string]FileProjection
+}
+
+// rollback restores the files of every pending source to the generation that
+// was mounted when the reloaders last succeeded, after the hook h failed with
+// cause. The rejected resourceVersions are not mounted again until the sources
+// change. Sources that cannot be rolled back, like those mounted for the first
+// time, stay pending so that they are reloaded. If nothing could be rolled
+// back, cause is returned so that the hook is retried.
+func (c *Controller) rollback(h reloader, cause error) error {
+	restored, skipped := make(changeSet), make(changeSet)
+	for _, key := range c.pending.sources() {
+		m, found := c.mounter(key)
+		rejected := c.pending[key].resourceVersion
+		if !found || rejected == "" {
+			// a deleted source has nothing to restore
+			skipped.add(key, c.pending[key])
+			continue
+		}
+		change, err := m.rollback()
+		if err != nil {
+			log.Errorf("Failed to roll back %s, cause %v\n", key, err)
+			skipped.add(key, c.pending[key])
+			continue
+		}
+		if change == nil {
+			skipped.add(key, c.pending[key])
+			continue
+		}
+		log.Errorf("Rolled back %s from resourceVersion %s to %s, cause %v\n", key, rejected, change.resourceVersion, cause)
+		c.reject(key, m, rejected)
+		incRollbackCounter(key)
+		setProjectedVersion(key, change.resourceVersion)
+		c.recorder.eventf([]*apiv1.ObjectReference{change.reference()}, apiv1.EventTypeWarning, eventReasonRolledBack,
+			"Rolled back %s from resourceVersion %s to %s after the boot command failed", key, rejected, change.resourceVersion)
+		restored.add(key, change)
+	}
+	if len(restored) == 0 {
+		return cause
+	}
+
+	c.pending = skipped
+	if !c.RerunAfterRollback {
+		if len(skipped) > 0 {
+			c.queue.Add(reloadQueueKey)
+		}
+		return nil
+	}
+	for key, change := range skipped {
+		restored.add(key, change)
+	}
+	start := time.Now()
+	err := h.reload(restored)
+	observeReload(h.action(), start, err)
+	c.recordHookEvent(restored, err)
+	if err != nil {
+		// retried like any failed hook, without rolling back any further
+		c.pending = restored
+		return fmt.Errorf("hook failed after rollback, cause %v", err)
+	}
+	c.commit(restored)
+	c.pending = make(changeSet)
+	return nil
+}
+
+// commit marks the mounted generation of every source in changes as the one
+// to roll back to.
+func (c *Controller) commit(changes changeSet) {
+	for key := range changes {
+		if m, found := c.mounter(key); found {
+			m.commit()
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+)
+
+func TestRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kloader-rollback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		name  string
+		rerun bool
+		// runs are the contents of app.conf the boot command saw, in order
+		runs []string
+	}{
+		{
+			name: "rollback",
+			runs: []string{"good", "bad"},
+		},
+		{
+			name:  "rerun after rollback",
+			rerun: true,
+			runs:  []string{"good", "bad", "good"},
+		},
+	}
+	for _, c := range cases {
+		mountPath := filepath.Join(dir, c.name)
+		if err := os.Mkdir(mountPath, 0755); err != nil {
+			t.Fatal(err)
+		}
+		runs := filepath.Join(dir, c.name+".runs")
+		ctrl := newTestController(Config{
+			// the boot command fails for bad files
+			Cmd:                `cat "$KLOADER_MOUNT_PATH/app.conf" >> "` + runs + `"; echo >> "` + runs + `"; ! grep -q bad "$KLOADER_MOUNT_PATH/app.conf"`,
+			RollbackOnFailure:  true,
+			RerunAfterRollback: c.rerun,
+		})
+		store := addTestMounter(t, ctrl, NewMounter(nil, NewSecretSource(nil), "default", "app", WithMountPath(mountPath)))
+		key := queueKey(kindSecret, "default", "app")
+		file := filepath.Join(mountPath, "app.conf")
+
+		store.Add(testSecret("1", "good"))
+		if err := ctrl.processItem(key); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if err := ctrl.runReloaders(); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		store.Update(testSecret("2", "bad"))
+		if err := ctrl.processItem(key); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if err := ctrl.runReloaders(); err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		}
+		if data, err := ioutil.ReadFile(file); err != nil || string(data) != "good" {
+			t.Errorf("%s: expected the previous generation to be restored, found %q: %v", c.name, data, err)
+		}
+		if len(ctrl.pending) != 0 {
+			t.Errorf("%s: expected no pending changes, found %v", c.name, ctrl.pending.sources())
+		}
+		if rejected := ctrl.rejected[key]; rejected == nil || rejected.version != "2" {
+			t.Errorf("%s: expected resourceVersion 2 to be rejected, found %+v", c.name, rejected)
+		}
+		data, err := ioutil.ReadFile(runs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found := strings.Fields(string(data)); strings.Join(found, " ") != strings.Join(c.runs, " ") {
+			t.Errorf("%s: expected the boot command to see %v, found %v", c.name, c.runs, found)
+		}
+
+		// the rejected resourceVersion is not mounted again until it changes
+		if err := ctrl.processItem(key); err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		}
+		if data, err := ioutil.ReadFile(file); err != nil || string(data) != "good" {
+			t.Errorf("%s: expected the rejected resourceVersion to be skipped, found %q: %v", c.name, data, err)
+		}
+		store.Update(testSecret("3", "fixed"))
+		if err := ctrl.processItem(key); err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		}
+		if data, err := ioutil.ReadFile(file); err != nil || string(data) != "fixed" {
+			t.Errorf("%s: expected the next resourceVersion to be mounted, found %q: %v", c.name, data, err)
+		}
+	}
+}
+
+func TestRollbackKeepsSkippedSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kloader-rollback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		name  string
+		rerun bool
+		// pending are the sources left to reload after the rollback
+		pending []string
+	}{
+		{
+			name:    "rollback",
+			pending: []string{queueKey(kindSecret, "default", "db")},
+		},
+		{
+			name:  "rerun after rollback",
+			rerun: true,
+		},
+	}
+	for _, c := range cases {
+		for _, name := range []string{"app", "db"} {
+			if err := os.MkdirAll(filepath.Join(dir, c.name, name), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		runs := filepath.Join(dir, c.name+".runs")
+		ctrl := newTestController(Config{
+			// the boot command fails while app.conf is bad
+			Cmd:                `echo "$KLOADER_SOURCES" >> "` + runs + `"; ! grep -q bad "` + filepath.Join(dir, c.name, "app", "app.conf") + `"`,
+			RollbackOnFailure:  true,
+			RerunAfterRollback: c.rerun,
+		})
+		app := addTestMounter(t, ctrl, NewMounter(nil, NewSecretSource(nil), "default", "app", WithMountPath(filepath.Join(dir, c.name, "app"))))
+		db := addTestMounter(t, ctrl, NewMounter(nil, NewSecretSource(nil), "default", "db", WithMountPath(filepath.Join(dir, c.name, "db"))))
+		appKey, dbKey := queueKey(kindSecret, "default", "app"), queueKey(kindSecret, "default", "db")
+
+		app.Add(testSecret("1", "good"))
+		if err := ctrl.processItem(appKey); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if err := ctrl.runReloaders(); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		// db is mounted for the first time along with a bad app, so it has
+		// no generation to roll back to
+		app.Update(testSecret("2", "bad"))
+		dbSecret := testSecret("1", "db")
+		dbSecret.Name = "db"
+		db.Add(dbSecret)
+		for _, key := range []string{appKey, dbKey} {
+			if err := ctrl.processItem(key); err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+		}
+		if err := ctrl.runReloaders(); err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		}
+		if pending := ctrl.pending.sources(); strings.Join(pending, " ") != strings.Join(c.pending, " ") {
+			t.Errorf("%s: expected %v to be pending, found %v", c.name, c.pending, pending)
+		}
+		if c.rerun {
+			data, err := ioutil.ReadFile(runs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			if last := lines[len(lines)-1]; last != appKey+" "+dbKey {
+				t.Errorf("%s: expected the rerun to reload %s and %s, found %q", c.name, appKey, dbKey, last)
+			}
+			continue
+		}
+
+		// the pending source is reloaded by the queued reload
+		if ctrl.queue.Len() != 1 {
+			t.Fatalf("%s: expected a reload to be queued, found %d queued keys", c.name, ctrl.queue.Len())
+		}
+		ctrl.processNextItem()
+		if len(ctrl.pending) != 0 {
+			t.Errorf("%s: expected no pending changes, found %v", c.name, ctrl.pending.sources())
+		}
+	}
+}
+
+func TestInherit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kloader-inherit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key := queueKey(kindSecret, "default", "app")
+	spec := v1alpha1.Source{MountPath: dir}
+
+	// the old controller mounted resourceVersion 1 without reloading it, and rejected 2
+	old := newTestController(Config{Cmd: "true"})
+	oldStore := addTestMounter(t, old, NewMounter(nil, NewSecretSource(nil), "default", "app", WithSpec(spec), WithMountPath(dir)))
+	oldStore.Add(testSecret("1", "v1"))
+	if err := old.processItem(key); err != nil {
+		t.Fatal(err)
+	}
+	old.reject(key, old.mounters[key], "2")
+
+	cases := []struct {
+		name     string
+		spec     v1alpha1.Source
+		rejected bool
+	}{
+		{name: "same source", spec: spec, rejected: true},
+		{name: "changed source", spec: v1alpha1.Source{MountPath: dir, Exclude: []string{"other.conf"}}},
+	}
+	for _, c := range cases {
+		ctrl := newTestController(Config{Cmd: "true"})
+		store := addTestMounter(t, ctrl, NewMounter(nil, NewSecretSource(nil), "default", "app", WithSpec(c.spec), WithMountPath(dir)))
+		ctrl.Inherit(old)
+
+		if _, found := ctrl.pending[key]; !found || !ctrl.reloadPending {
+			t.Errorf("%s: expected the pending change to be inherited, found %v", c.name, ctrl.pending.sources())
+		}
+		store.Add(testSecret("2", "v2"))
+		if err := ctrl.processItem(key); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, "app.conf"))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if mounted := string(data) == "v2"; mounted == c.rejected {
+			t.Errorf("%s: expected the rejected resourceVersion to be skipped %v, found %q", c.name, c.rejected, data)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+	apiv1 "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// selectorSource projects every object of a Source matching a label selector
+// into a subdirectory of its mount location, named after the object.
+type selectorSource struct {
+	source Source
+	spec   v1alpha1.Source
+}
+
+// addSelector watches the objects of source in namespace matching selector.
+func (c *Controller) addSelector(source Source, ns, selector string, spec v1alpha1.Source) {
+	if ns == "" {
+		ns = namespace()
+	}
+	key := c.informers.watchSelector(source, ns, selector)
+	c.selectors[key] = &selectorSource{source: source, spec: spec}
+}
+
+// selectedMounter returns the mounter of the object name matched by the
+// selector with informer key sel, and creates it if needed. It returns false
+// if a named source or another selector already mounts the object.
+func (c *Controller) selectedMounter(sel informerKey, name string) (string, bool) {
+	key := queueKey(sel.kind, sel.namespace, name)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if owner, found := c.selected[key]; found {
+		return key, owner == sel
+	}
+	if _, found := c.mounters[key]; found {
+		log.Infof("Ignoring %s matching %s, it is already mounted by name\n", key, sel.selector)
+		return key, false
+	}
+
+	s := c.selectors[sel]
+	m := NewMounter(c.KubeClient, s.source, sel.namespace, name, WithSpec(s.spec), WithMountPath(filepath.Join(s.spec.MountPath, name)))
+	m.getObject = c.cachedObject
+	c.mounters[key] = m
+	c.selected[key] = sel
+	return key, true
+}
+
+// selectedDir returns the subdirectory of an object matching a selector and
+// its informer key, or false if the object was not matched by a selector.
+func (c *Controller) selectedDir(key string) (string, informerKey, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	sel, found := c.selected[key]
+	if !found {
+		return "", sel, false
+	}
+	_, _, name := splitQueueKey(key)
+	return filepath.Join(c.selectors[sel].spec.MountPath, name), sel, true
+}
+
+// selectorMarkerName is the file in the subdirectory of every object matching
+// a selector that records the selector. Only subdirectories with a marker of
+// their selector are ever removed. Like every path starting with "..", it is
+// not touched by the AtomicWriter.
+const selectorMarkerName = "..kloader_selector"
+
+// createSelectedDir creates the subdirectory of an object matching a
+// selector, and marks it as created for the selector.
+func (c *Controller) createSelectedDir(key string) error {
+	dir, sel, found := c.selectedDir(key)
+	if !found {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s, cause %v", dir, err)
+	}
+	if isSelectedDir(dir, sel) {
+		return nil
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, selectorMarkerName), []byte(sel.selector), 0644); err != nil {
+		return fmt.Errorf("failed to mark %s, cause %v", dir, err)
+	}
+	return nil
+}
+
+// isSelectedDir reports whether dir was created for an object matching the
+// selector with informer key sel.
+func isSelectedDir(dir string, sel informerKey) bool {
+	data, err := ioutil.ReadFile(filepath.Join(dir, selectorMarkerName))
+	return err == nil && string(data) == sel.selector
+}
+
+// removeSelected removes the files and the subdirectory of an object that was
+// deleted or no longer matches its selector, and forgets its mounter.
+func (c *Controller) removeSelected(key string) error {
+	m, found := c.mounter(key)
+	dir, sel, selected := c.selectedDir(key)
+	if !found || !selected {
+		return nil
+	}
+	var change *change
+	if _, err := os.Stat(dir); err == nil {
+		if change, err = m.clear(); err != nil {
+			return err
+		}
+	}
+	if isSelectedDir(dir, sel) {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to remove %s, cause %v", dir, err)
+		}
+		log.Infof("Removed %s of %s\n", dir, key)
+	}
+
+	c.lock.Lock()
+	delete(c.mounters, key)
+	delete(c.selected, key)
+	delete(c.waiting, key)
+	c.synced.Delete(key)
+	c.lock.Unlock()
+	incDeleteCounter(key, v1alpha1.DeletePolicyClear)
+	c.recorder.eventf([]*apiv1.ObjectReference{m.reference(nil)}, apiv1.EventTypeNormal, eventReasonSourceDeleted,
+		"%s was deleted or no longer matches %s, removed %s", key, sel.selector, dir)
+	c.addChange(key, change)
+	return nil
+}
+
+// pruneSelected queues the subdirectories created by kloader for objects that
+// no longer match their selector, for example after they were unlabeled while
+// kloader was not running. It must be called once the informers have synced.
+func (c *Controller) pruneSelected() {
+	for sel, s := range c.selectors {
+		entries, err := ioutil.ReadDir(s.spec.MountPath)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			if !isSelectedDir(filepath.Join(s.spec.MountPath, entry.Name()), sel) {
+				continue
+			}
+			if key, owned := c.selectedMounter(sel, entry.Name()); owned {
+				c.queue.Add(key)
+			}
+		}
+	}
+}
+
+// listSelected creates the mounters of every object that currently matches a
+// selector, without starting any informer. It returns a *SyncError if listing
+// was forbidden.
+func (c *Controller) listSelected() error {
+	for sel, s := range c.selectors {
+		list, err := s.source.ListWatch(sel.namespace, func(opts *metav1.ListOptions) {
+			opts.LabelSelector = sel.selector
+		}).List(metav1.ListOptions{})
+		if kerr.IsForbidden(err) {
+			return &SyncError{Reason: SyncForbidden, Err: fmt.Errorf("failed to list %ss matching %s, cause %v", sel.kind, sel.selector, err)}
+		} else if err != nil {
+			return fmt.Errorf("failed to list %ss matching %s, cause %v", sel.kind, sel.selector, err)
+		}
+		objs, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			accessor, err := meta.Accessor(obj)
+			if err != nil {
+				return err
+			}
+			key, owned := c.selectedMounter(sel, accessor.GetName())
+			if !owned {
+				continue
+			}
+			if err := c.createSelectedDir(key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
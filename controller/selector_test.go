@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestPruneSelected(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kloader-selector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctrl := newTestController(Config{})
+	source := NewSecretSource(nil)
+	ctrl.addSelector(source, "default", "app=web", v1alpha1.Source{MountPath: dir})
+	sel := informerKey{kind: kindSecret, namespace: "default", selector: "app=web"}
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, source.NewObject(), 0, cache.Indexers{})
+	ctrl.informers.informers[sel] = informer
+	informer.GetIndexer().Add(testSecret("1", "v1"))
+
+	cases := []struct {
+		name   string
+		marker string
+		kept   bool
+	}{
+		{name: "app", marker: "app=web", kept: true},
+		{name: "stale", marker: "app=web"},
+		// the mountPath of another source or a directory of the user
+		{name: "unmarked", kept: true},
+		{name: "other-selector", marker: "app=db", kept: true},
+	}
+	for _, c := range cases {
+		sub := filepath.Join(dir, c.name)
+		if err := os.Mkdir(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writePayload(sub, kindSecret, "default", c.name, map[string]FileProjection{"app.conf": {Data: []byte("old"), Mode: 0644}}); err != nil {
+			t.Fatal(err)
+		}
+		if c.marker != "" {
+			if err := ioutil.WriteFile(filepath.Join(sub, selectorMarkerName), []byte(c.marker), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	ctrl.pruneSelected()
+	for ctrl.queue.Len() > 0 {
+		ctrl.processNextItem()
+	}
+	for _, c := range cases {
+		_, err := os.Stat(filepath.Join(dir, c.name, "app.conf"))
+		if c.kept && err != nil {
+			t.Errorf("%s: expected the files to be kept, found %v", c.name, err)
+		} else if !c.kept && !os.IsNotExist(err) {
+			t.Errorf("%s: expected the directory to be removed, found %v", c.name, err)
+		}
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "app", "app.conf")); err != nil || string(data) != "v1" {
+		t.Errorf("expected the matching Secret to be mounted, found %q: %v", data, err)
+	}
+}
@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+)
+
+const procDir = "/proc"
+
+// signaler sends a signal to a process in the shared process namespace of
+// the pod, without involving a shell.
+type signaler struct {
+	spec v1alpha1.SignalProcess
+}
+
+func (s *signaler) action() string { return "signal" }
+
+func (s *signaler) reload(changes changeSet) error {
+	signal, found := v1alpha1.ParseSignal(s.spec.Signal)
+	if !found {
+		return fmt.Errorf("unsupported signal %s", s.spec.Signal)
+	}
+
+	pids, err := s.findProcesses()
+	if err != nil {
+		return err
+	}
+	if len(pids) == 0 {
+		return fmt.Errorf("no process found with %s", s)
+	}
+	return s.signal(pids, signal)
+}
+
+// signal sends signal to every process in pids. A process that exited since
+// it was found is skipped, and so is one that cannot be signalled, as long as
+// another one received the signal.
+func (s *signaler) signal(pids []int, signal syscall.Signal) error {
+	var lastErr error
+	signalled := 0
+	for _, pid := range pids {
+		log.Infof("Sending %v to process %d\n", signal, pid)
+		err := syscall.Kill(pid, signal)
+		switch {
+		case err == nil:
+			signalled++
+		case err == syscall.ESRCH:
+			log.Infof("Skipping process %d, it exited\n", pid)
+		default:
+			log.Errorf("Failed to send %v to process %d, cause %v\n", signal, pid, err)
+			lastErr = fmt.Errorf("failed to send %v to process %d, cause %v", signal, pid, err)
+		}
+	}
+	if signalled > 0 {
+		return nil
+	}
+	if lastErr != nil {
+		return lastErr
+	}
+	return fmt.Errorf("no process found with %s, every process exited before it was signalled", s)
+}
+
+func (s *signaler) String() string {
+	switch {
+	case s.spec.PIDFile != "":
+		return "pidfile " + s.spec.PIDFile
+	case s.spec.Cgroup != "":
+		return "cgroup " + s.spec.Cgroup
+	default:
+		return "name " + s.spec.Name
+	}
+}
+
+func (s *signaler) findProcesses() ([]int, error) {
+	if s.spec.PIDFile != "" {
+		data, err := ioutil.ReadFile(s.spec.PIDFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pidfile %s, cause %v", s.spec.PIDFile, err)
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pidfile %s, cause %v", s.spec.PIDFile, err)
+		}
+		// kill(2) signals a whole process group for 0 and every process for
+		// -1, so only the pid of another single process is accepted.
+		if pid <= 0 {
+			return nil, fmt.Errorf("invalid pidfile %s, pid %d is not positive", s.spec.PIDFile, pid)
+		}
+		if pid == os.Getpid() {
+			return nil, fmt.Errorf("invalid pidfile %s, pid %d is kloader itself", s.spec.PIDFile, pid)
+		}
+		return []int{pid}, nil
+	}
+
+	entries, err := ioutil.ReadDir(procDir)
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		if s.matches(pid) {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// matches reports whether the process is selected by cgroup or by name. The
+// name is compared to both /proc/<pid>/comm and the base name of argv[0].
+func (s *signaler) matches(pid int) bool {
+	dir := filepath.Join(procDir, strconv.Itoa(pid))
+	if s.spec.Cgroup != "" {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "cgroup"))
+		return err == nil && inCgroup(string(data), s.spec.Cgroup)
+	}
+
+	if comm, err := ioutil.ReadFile(filepath.Join(dir, "comm")); err == nil && strings.TrimSpace(string(comm)) == s.spec.Name {
+		return true
+	}
+	if cmdline, err := ioutil.ReadFile(filepath.Join(dir, "cmdline")); err == nil && len(cmdline) > 0 {
+		argv0 := strings.SplitN(string(cmdline), "\x00", 2)[0]
+		return filepath.Base(argv0) == s.spec.Name
+	}
+	return false
+}
+
+// inCgroup reports whether a path listed in data, the content of a
+// /proc/<pid>/cgroup file, contains cgroup as whole path components. An
+// absolute cgroup must match from the root, so /kubepods/pod1 selects
+// /kubepods/pod1 and /kubepods/pod1/abc, but not /kubepods/pod12. A relative
+// cgroup, like a container ID, may match anywhere in the path.
+func inCgroup(data, cgroup string) bool {
+	want := splitCgroup(cgroup)
+	if len(want) == 0 {
+		return false
+	}
+	for _, line := range strings.Split(data, "\n") {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		have := splitCgroup(parts[2])
+		for i := 0; i+len(want) <= len(have); i++ {
+			if equalStrings(have[i:i+len(want)], want) {
+				return true
+			}
+			if strings.HasPrefix(cgroup, "/") {
+				break
+			}
+		}
+	}
+	return false
+}
+
+func splitCgroup(path string) []string {
+	var components []string
+	for _, c := range strings.Split(path, "/") {
+		if c != "" {
+			components = append(components, c)
+		}
+	}
+	return components
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+)
+
+func TestInCgroup(t *testing.T) {
+	data := `12:memory:/kubepods/burstable/pod1234/abcdef
+11:cpu,cpuacct:/kubepods/burstable/pod1234/abcdef
+0::/
+`
+	cases := []struct {
+		cgroup  string
+		matches bool
+	}{
+		{"/kubepods/burstable/pod1234", true},
+		{"/kubepods/burstable/pod1234/abcdef", true},
+		{"/kubepods/burstable/pod1234/", true},
+		{"/kubepods/burstable/pod12", false},
+		{"/burstable/pod1234", false},
+		{"pod1234/abcdef", true},
+		{"abcdef", true},
+		{"abc", false},
+		{"pod1234/abc", false},
+		{"/", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		if matches := inCgroup(data, c.cgroup); matches != c.matches {
+			t.Errorf("%q: expected %v, found %v", c.cgroup, c.matches, matches)
+		}
+	}
+}
+
+func TestFindProcessesPIDFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pidfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		pid string
+		err string
+	}{
+		{"0", "pid 0 is not positive"},
+		{"-1", "pid -1 is not positive"},
+		{strconv.Itoa(os.Getpid()), "is kloader itself"},
+		{"nan", "invalid syntax"},
+		{"4242\n", ""},
+	}
+	for _, c := range cases {
+		pidFile := filepath.Join(dir, "pid")
+		if err := ioutil.WriteFile(pidFile, []byte(c.pid), 0644); err != nil {
+			t.Fatal(err)
+		}
+		s := &signaler{spec: v1alpha1.SignalProcess{PIDFile: pidFile}}
+		pids, err := s.findProcesses()
+		if c.err == "" {
+			if err != nil || len(pids) != 1 || pids[0] != 4242 {
+				t.Errorf("%q: expected pid 4242, found %v, %v", c.pid, pids, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%q: expected error %q, found %v, %v", c.pid, c.err, pids, err)
+		}
+	}
+}
+
+func TestSignal(t *testing.T) {
+	// the pid of a process that exited and was reaped
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Fatal(err)
+	}
+	s := &signaler{spec: v1alpha1.SignalProcess{Name: "sleep"}}
+
+	if err := s.signal([]int{exited.Process.Pid}, syscall.SIGTERM); err == nil || !strings.Contains(err.Error(), "every process exited") {
+		t.Errorf("expected an error if no process was signalled, found %v", err)
+	}
+
+	running := exec.Command("sleep", "60")
+	if err := running.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer running.Process.Kill()
+	if err := s.signal([]int{exited.Process.Pid, running.Process.Pid}, syscall.SIGTERM); err != nil {
+		t.Errorf("expected the exited process to be skipped, found %v", err)
+	}
+	if err := running.Wait(); err == nil || !strings.Contains(err.Error(), "terminated") {
+		t.Errorf("expected the running process to receive the signal, found %v", err)
+	}
+}
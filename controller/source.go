@@ -0,0 +1,343 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	apiv1 "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer/streaming"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	restwatch "k8s.io/client-go/rest/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	kindConfigMap = "configmap"
+	kindSecret    = "secret"
+
+	configMapDefaultMode int32 = 0777
+	secretDefaultMode    int32 = 0400
+)
+
+// Source is a kind of object whose data is projected into files by a Mounter.
+// Implementations must be safe for concurrent use.
+type Source interface {
+	// Kind names the source in queue keys, metrics and the KLOADER_SOURCE_KIND
+	// variable of the hook, like "configmap". It must not contain '/'.
+	Kind() string
+	// GroupVersionKind of the objects, used in Events.
+	GroupVersionKind() schema.GroupVersionKind
+	// DefaultMode of the projected files, unless the spec sets one.
+	DefaultMode() int32
+	// NewObject returns an empty object, used by informers.
+	NewObject() runtime.Object
+	// ListWatch lists and watches the objects in namespace. tweak restricts
+	// the options of every call, like to a single name or a label selector.
+	ListWatch(namespace string, tweak func(*metav1.ListOptions)) *cache.ListWatch
+	// Get fetches a single object from the API server.
+	Get(namespace, name string) (runtime.Object, error)
+	// Data returns the keys of obj and their values.
+	Data(obj runtime.Object) (map[string][]byte, error)
+	// DataChanged reports whether the Data of new may differ from old.
+	DataChanged(old, new runtime.Object) bool
+}
+
+// WritableSource is a Source whose data can be updated from the mounted files.
+type WritableSource interface {
+	Source
+	// Update sets the keys in data and removes the keys in removed from the
+	// object namespace/name. The API server rejects the update with a
+	// Conflict error unless the object is still at resourceVersion.
+	Update(namespace, name, resourceVersion string, data map[string][]byte, removed []string) (runtime.Object, error)
+}
+
+// mergePatch returns a JSON merge patch that sets the keys of every field,
+// like data, to their values and requires the object to be at
+// resourceVersion. A nil value removes the key. Empty fields are left out.
+func mergePatch(resourceVersion string, fields map[string]map[string]interface{}) ([]byte, error) {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{"resourceVersion": resourceVersion},
+	}
+	for field, values := range fields {
+		if len(values) > 0 {
+			patch[field] = values
+		}
+	}
+	return json.Marshal(patch)
+}
+
+// NewConfigMapSource projects the data and binaryData of ConfigMaps.
+func NewConfigMapSource(client clientset.Interface) Source {
+	return &configMapSource{client: client}
+}
+
+type configMapSource struct {
+	client clientset.Interface
+}
+
+// configMap is a ConfigMap with its binaryData. The vendored k8s.io/api
+// predates ConfigMap.BinaryData (added in Kubernetes 1.10), so ConfigMaps are
+// read through the REST client into this type instead. Drop it once
+// client-go is bumped.
+type configMap struct {
+	apiv1.ConfigMap `json:",inline"`
+	BinaryData      map[string][]byte `json:"binaryData,omitempty"`
+}
+
+func (in *configMap) DeepCopyObject() runtime.Object {
+	out := &configMap{ConfigMap: *in.ConfigMap.DeepCopy()}
+	if in.BinaryData != nil {
+		out.BinaryData = make(map[string][]byte, len(in.BinaryData))
+		for k, v := range in.BinaryData {
+			out.BinaryData[k] = append([]byte(nil), v...)
+		}
+	}
+	return out
+}
+
+type configMapList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []configMap `json:"items"`
+}
+
+func (in *configMapList) DeepCopyObject() runtime.Object {
+	out := &configMapList{TypeMeta: in.TypeMeta, ListMeta: in.ListMeta}
+	for i := range in.Items {
+		out.Items = append(out.Items, *in.Items[i].DeepCopyObject().(*configMap))
+	}
+	return out
+}
+
+// configMapDecoder decodes the objects of watch events into a configMap, or
+// a metav1.Status if the watch failed.
+type configMapDecoder struct{}
+
+func (configMapDecoder) Decode(data []byte, _ *schema.GroupVersionKind, _ runtime.Object) (runtime.Object, *schema.GroupVersionKind, error) {
+	var typeMeta metav1.TypeMeta
+	if err := json.Unmarshal(data, &typeMeta); err != nil {
+		return nil, nil, err
+	}
+	var obj runtime.Object = &configMap{}
+	if typeMeta.Kind == "Status" {
+		obj = &metav1.Status{}
+	}
+	if err := json.Unmarshal(data, obj); err != nil {
+		return nil, nil, err
+	}
+	gvk := typeMeta.GroupVersionKind()
+	return obj, &gvk, nil
+}
+
+func (s *configMapSource) Kind() string { return kindConfigMap }
+
+func (s *configMapSource) GroupVersionKind() schema.GroupVersionKind {
+	return apiv1.SchemeGroupVersion.WithKind("ConfigMap")
+}
+
+func (s *configMapSource) DefaultMode() int32 { return configMapDefaultMode }
+
+func (s *configMapSource) NewObject() runtime.Object { return &configMap{} }
+
+func (s *configMapSource) ListWatch(namespace string, tweak func(*metav1.ListOptions)) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			tweak(&opts)
+			list := &configMapList{}
+			err := s.client.CoreV1().RESTClient().Get().
+				Namespace(namespace).
+				Resource("configmaps").
+				VersionedParams(&opts, scheme.ParameterCodec).
+				Do().
+				Into(list)
+			return list, err
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			tweak(&opts)
+			opts.Watch = true
+			body, err := s.client.CoreV1().RESTClient().Get().
+				Namespace(namespace).
+				Resource("configmaps").
+				VersionedParams(&opts, scheme.ParameterCodec).
+				Stream()
+			if err != nil {
+				return nil, err
+			}
+			info, _ := runtime.SerializerInfoForMediaType(scheme.Codecs.SupportedMediaTypes(), runtime.ContentTypeJSON)
+			decoder := streaming.NewDecoder(info.StreamSerializer.Framer.NewFrameReader(body), info.StreamSerializer.Serializer)
+			return watch.NewStreamWatcher(restwatch.NewDecoder(decoder, configMapDecoder{})), nil
+		},
+	}
+}
+
+func (s *configMapSource) Get(namespace, name string) (runtime.Object, error) {
+	obj := &configMap{}
+	err := s.client.CoreV1().RESTClient().Get().
+		Namespace(namespace).
+		Resource("configmaps").
+		Name(name).
+		Do().
+		Into(obj)
+	return obj, err
+}
+
+func (s *configMapSource) Data(obj runtime.Object) (map[string][]byte, error) {
+	cm, ok := obj.(*configMap)
+	if !ok {
+		return nil, fmt.Errorf("expected ConfigMap, found %T", obj)
+	}
+
+	data := make(map[string][]byte)
+	for k, v := range cm.Data {
+		data[k] = []byte(v)
+	}
+	var duplicates []string
+	for k, v := range cm.BinaryData {
+		if _, found := data[k]; found {
+			duplicates = append(duplicates, k)
+			continue
+		}
+		data[k] = v
+	}
+	if len(duplicates) > 0 {
+		sort.Strings(duplicates)
+		return nil, fmt.Errorf("keys %s found in both data and binaryData of ConfigMap %s/%s", strings.Join(duplicates, ", "), cm.Namespace, cm.Name)
+	}
+	return data, nil
+}
+
+func (s *configMapSource) DataChanged(old, new runtime.Object) bool {
+	if oldMap, oldOK := old.(*configMap); oldOK {
+		if newMap, newOK := new.(*configMap); newOK {
+			return !reflect.DeepEqual(oldMap.Data, newMap.Data) || !reflect.DeepEqual(oldMap.BinaryData, newMap.BinaryData)
+		}
+	}
+	return false
+}
+
+// Update patches data and binaryData instead of updating the whole object.
+// A key is written to binaryData if it is there already or is not valid
+// UTF-8, and a removed key is removed from the field that holds it. Which
+// field holds a key is read from the object at resourceVersion.
+func (s *configMapSource) Update(namespace, name, resourceVersion string, data map[string][]byte, removed []string) (runtime.Object, error) {
+	obj, err := s.Get(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	cm := obj.(*configMap)
+	if cm.ResourceVersion != resourceVersion {
+		return nil, kerr.NewConflict(schema.GroupResource{Resource: "configmaps"}, name,
+			fmt.Errorf("it was changed since resourceVersion %s", resourceVersion))
+	}
+
+	values, binaryValues := make(map[string]interface{}), make(map[string]interface{})
+	for k, v := range data {
+		if _, binary := cm.BinaryData[k]; binary || !utf8.Valid(v) {
+			binaryValues[k] = v
+			if _, found := cm.Data[k]; found {
+				values[k] = nil
+			}
+		} else {
+			values[k] = string(v)
+		}
+	}
+	for _, k := range removed {
+		if _, binary := cm.BinaryData[k]; binary {
+			binaryValues[k] = nil
+		} else {
+			values[k] = nil
+		}
+	}
+	patch, err := mergePatch(resourceVersion, map[string]map[string]interface{}{"data": values, "binaryData": binaryValues})
+	if err != nil {
+		return nil, err
+	}
+	obj = &configMap{}
+	err = s.client.CoreV1().RESTClient().Patch(types.MergePatchType).
+		Namespace(namespace).
+		Resource("configmaps").
+		Name(name).
+		Body(patch).
+		Do().
+		Into(obj)
+	return obj, err
+}
+
+// NewSecretSource projects the data of Secrets.
+func NewSecretSource(client clientset.Interface) Source {
+	return &secretSource{client: client}
+}
+
+type secretSource struct {
+	client clientset.Interface
+}
+
+func (s *secretSource) Kind() string { return kindSecret }
+
+func (s *secretSource) GroupVersionKind() schema.GroupVersionKind {
+	return apiv1.SchemeGroupVersion.WithKind("Secret")
+}
+
+func (s *secretSource) DefaultMode() int32 { return secretDefaultMode }
+
+func (s *secretSource) NewObject() runtime.Object { return &apiv1.Secret{} }
+
+func (s *secretSource) ListWatch(namespace string, tweak func(*metav1.ListOptions)) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			tweak(&opts)
+			return s.client.CoreV1().Secrets(namespace).List(opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			tweak(&opts)
+			return s.client.CoreV1().Secrets(namespace).Watch(opts)
+		},
+	}
+}
+
+func (s *secretSource) Get(namespace, name string) (runtime.Object, error) {
+	return s.client.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+}
+
+func (s *secretSource) Data(obj runtime.Object) (map[string][]byte, error) {
+	secret, ok := obj.(*apiv1.Secret)
+	if !ok {
+		return nil, fmt.Errorf("expected Secret, found %T", obj)
+	}
+	return secret.Data, nil
+}
+
+func (s *secretSource) DataChanged(old, new runtime.Object) bool {
+	if oldSecret, oldOK := old.(*apiv1.Secret); oldOK {
+		if newSecret, newOK := new.(*apiv1.Secret); newOK {
+			return !reflect.DeepEqual(oldSecret.Data, newSecret.Data)
+		}
+	}
+	return false
+}
+
+func (s *secretSource) Update(namespace, name, resourceVersion string, data map[string][]byte, removed []string) (runtime.Object, error) {
+	values := make(map[string]interface{})
+	for k, v := range data {
+		values[k] = v
+	}
+	for _, k := range removed {
+		values[k] = nil
+	}
+	patch, err := mergePatch(resourceVersion, map[string]map[string]interface{}{"data": values})
+	if err != nil {
+		return nil, err
+	}
+	return s.client.CoreV1().Secrets(namespace).Patch(name, types.MergePatchType, patch)
+}
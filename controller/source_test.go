@@ -0,0 +1,270 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestConfigMapData(t *testing.T) {
+	cases := []struct {
+		name string
+		json string
+		data map[string][]byte
+		err  string
+	}{
+		{
+			name: "data and binaryData",
+			json: `{"kind":"ConfigMap","apiVersion":"v1","metadata":{"name":"a","namespace":"ns"},"data":{"x":"1"},"binaryData":{"b":"AAE="}}`,
+			data: map[string][]byte{"x": []byte("1"), "b": {0, 1}},
+		},
+		{
+			name: "data only",
+			json: `{"kind":"ConfigMap","apiVersion":"v1","metadata":{"name":"a","namespace":"ns"},"data":{"x":"1"}}`,
+			data: map[string][]byte{"x": []byte("1")},
+		},
+		{
+			name: "duplicate keys",
+			json: `{"kind":"ConfigMap","apiVersion":"v1","metadata":{"name":"a","namespace":"ns"},"data":{"x":"1"},"binaryData":{"x":"AAE="}}`,
+			err:  "keys x found in both data and binaryData of ConfigMap ns/a",
+		},
+	}
+	s := NewConfigMapSource(nil)
+	for _, c := range cases {
+		obj, _, err := configMapDecoder{}.Decode([]byte(c.json), nil, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		data, err := s.Data(obj)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected error %q, found %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		} else if !reflect.DeepEqual(data, c.data) {
+			t.Errorf("%s: expected %q, found %q", c.name, c.data, data)
+		}
+	}
+}
+
+func TestConfigMapDataChanged(t *testing.T) {
+	s := NewConfigMapSource(nil)
+	decode := func(json string) *configMap {
+		obj, _, err := configMapDecoder{}.Decode([]byte(json), nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return obj.(*configMap)
+	}
+	old := decode(`{"kind":"ConfigMap","metadata":{"name":"a","resourceVersion":"1"},"data":{"x":"1"},"binaryData":{"b":"AAE="}}`)
+	relabeled := decode(`{"kind":"ConfigMap","metadata":{"name":"a","resourceVersion":"2","labels":{"a":"b"}},"data":{"x":"1"},"binaryData":{"b":"AAE="}}`)
+	binary := decode(`{"kind":"ConfigMap","metadata":{"name":"a","resourceVersion":"3"},"data":{"x":"1"},"binaryData":{"b":"AAI="}}`)
+	if s.DataChanged(old, relabeled) {
+		t.Errorf("a metadata change must not be a data change")
+	}
+	if !s.DataChanged(old, binary) {
+		t.Errorf("a binaryData change must be a data change")
+	}
+	if copied := binary.DeepCopyObject().(*configMap); !reflect.DeepEqual(copied, binary) {
+		t.Errorf("expected a deep copy, found %#v", copied)
+	}
+}
+
+// configMapServer serves a single ConfigMap like the API server does for
+// GET and JSON merge PATCH requests.
+type configMapServer struct {
+	*httptest.Server
+
+	lock    sync.Mutex
+	cm      *configMap
+	patches int
+}
+
+func newConfigMapServer(cm *configMap) *configMapServer {
+	s := &configMapServer{cm: cm}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// set replaces the ConfigMap, like an update by another client.
+func (s *configMapServer) set(cm *configMap) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cm = cm
+}
+
+func (s *configMapServer) get() *configMap {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.cm.DeepCopyObject().(*configMap)
+}
+
+func (s *configMapServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	status := func(code int, reason metav1.StatusReason, message string) {
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(&metav1.Status{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Status"},
+			Status:   metav1.StatusFailure,
+			Reason:   reason,
+			Message:  message,
+			Code:     int32(code),
+		})
+	}
+	if r.URL.Path != "/api/v1/namespaces/"+s.cm.Namespace+"/configmaps/"+s.cm.Name {
+		status(http.StatusNotFound, metav1.StatusReasonNotFound, r.URL.Path+" not found")
+		return
+	}
+	if r.Method == "PATCH" {
+		s.patches++
+		var patch struct {
+			Metadata struct {
+				ResourceVersion string `json:"resourceVersion"`
+			} `json:"metadata"`
+			Data       map[string]*string `json:"data"`
+			BinaryData map[string]*[]byte `json:"binaryData"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			status(http.StatusBadRequest, metav1.StatusReasonBadRequest, err.Error())
+			return
+		}
+		if patch.Metadata.ResourceVersion != s.cm.ResourceVersion {
+			status(http.StatusConflict, metav1.StatusReasonConflict, "the object has been modified")
+			return
+		}
+		cm := s.cm.DeepCopyObject().(*configMap)
+		for k, v := range patch.Data {
+			if cm.Data == nil {
+				cm.Data = make(map[string]string)
+			}
+			if v == nil {
+				delete(cm.Data, k)
+			} else {
+				cm.Data[k] = *v
+			}
+		}
+		for k, v := range patch.BinaryData {
+			if cm.BinaryData == nil {
+				cm.BinaryData = make(map[string][]byte)
+			}
+			if v == nil {
+				delete(cm.BinaryData, k)
+			} else {
+				cm.BinaryData[k] = *v
+			}
+		}
+		for k := range cm.Data {
+			if _, found := cm.BinaryData[k]; found {
+				status(http.StatusUnprocessableEntity, metav1.StatusReasonInvalid, "duplicate of key "+k+" in data and binaryData")
+				return
+			}
+		}
+		rv, _ := strconv.Atoi(cm.ResourceVersion)
+		cm.ResourceVersion = strconv.Itoa(rv + 1)
+		s.cm = cm
+	}
+	json.NewEncoder(w).Encode(s.cm)
+}
+
+func TestConfigMapUpdate(t *testing.T) {
+	cases := []struct {
+		name            string
+		resourceVersion string
+		data            map[string][]byte
+		removed         []string
+		// expected holds the data and binaryData after the update
+		expected       map[string]string
+		expectedBinary map[string][]byte
+		conflict       bool
+	}{
+		{
+			name:           "text key",
+			data:           map[string][]byte{"app.conf": []byte("new")},
+			expected:       map[string]string{"app.conf": "new", "other.conf": "other"},
+			expectedBinary: map[string][]byte{"logo.png": {0x89, 'P'}, "ascii.bin": []byte("abc")},
+		},
+		{
+			name:           "key in binaryData stays there",
+			data:           map[string][]byte{"ascii.bin": []byte("xyz"), "logo.png": {0x89, 'Q'}},
+			expected:       map[string]string{"app.conf": "app", "other.conf": "other"},
+			expectedBinary: map[string][]byte{"logo.png": {0x89, 'Q'}, "ascii.bin": []byte("xyz")},
+		},
+		{
+			name:           "new key that is not UTF-8",
+			data:           map[string][]byte{"icon.ico": {0xff, 0xfe}},
+			expected:       map[string]string{"app.conf": "app", "other.conf": "other"},
+			expectedBinary: map[string][]byte{"logo.png": {0x89, 'P'}, "ascii.bin": []byte("abc"), "icon.ico": {0xff, 0xfe}},
+		},
+		{
+			name:           "text key that is no longer UTF-8",
+			data:           map[string][]byte{"app.conf": {0xff}},
+			expected:       map[string]string{"other.conf": "other"},
+			expectedBinary: map[string][]byte{"logo.png": {0x89, 'P'}, "ascii.bin": []byte("abc"), "app.conf": {0xff}},
+		},
+		{
+			name:           "removed keys",
+			removed:        []string{"logo.png", "other.conf"},
+			expected:       map[string]string{"app.conf": "app"},
+			expectedBinary: map[string][]byte{"ascii.bin": []byte("abc")},
+		},
+		{
+			name:            "stale resourceVersion",
+			resourceVersion: "0",
+			data:            map[string][]byte{"app.conf": []byte("new")},
+			conflict:        true,
+		},
+	}
+	for _, c := range cases {
+		srv := newConfigMapServer(&configMap{
+			ConfigMap: apiv1.ConfigMap{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", ResourceVersion: "1"},
+				Data:       map[string]string{"app.conf": "app", "other.conf": "other"},
+			},
+			BinaryData: map[string][]byte{"logo.png": {0x89, 'P'}, "ascii.bin": []byte("abc")},
+		})
+		source := NewConfigMapSource(clientset.NewForConfigOrDie(&rest.Config{Host: srv.URL})).(WritableSource)
+		resourceVersion := c.resourceVersion
+		if resourceVersion == "" {
+			resourceVersion = "1"
+		}
+		_, err := source.Update("default", "app", resourceVersion, c.data, c.removed)
+		srv.Close()
+		if c.conflict {
+			if !kerr.IsConflict(err) {
+				t.Errorf("%s: expected a conflict, found %v", c.name, err)
+			}
+			if srv.patches != 0 {
+				t.Errorf("%s: expected no patch, found %d", c.name, srv.patches)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+			continue
+		}
+		cm := srv.get()
+		if !reflect.DeepEqual(cm.Data, c.expected) {
+			t.Errorf("%s: expected data %q, found %q", c.name, c.expected, cm.Data)
+		}
+		if !reflect.DeepEqual(cm.BinaryData, c.expectedBinary) {
+			t.Errorf("%s: expected binaryData %q, found %q", c.name, c.expectedBinary, cm.BinaryData)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/appscode/go/log"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const syncPollInterval = 2 * time.Second
+
+// SyncFailure tells which step of SyncOnce failed.
+type SyncFailure string
+
+const (
+	SyncNotFound  SyncFailure = "NotFound"
+	SyncForbidden SyncFailure = "Forbidden"
+	// SyncWriteFailed means the files of a source could not be written to disk.
+	SyncWriteFailed  SyncFailure = "WriteFailed"
+	SyncReloadFailed SyncFailure = "ReloadFailed"
+	// SyncRequirementsNotMet means a source still missed required keys,
+	// annotations or labels when the timeout expired.
+	SyncRequirementsNotMet SyncFailure = "RequirementsNotMet"
+	// SyncValidationFailed means the files of a source were rejected by its validation.
+	SyncValidationFailed SyncFailure = "ValidationFailed"
+	// SyncMissingData means keys listed in the items of a source do not exist.
+	SyncMissingData SyncFailure = "MissingData"
+	// SyncRenderFailed means the data of a source could not be turned into
+	// files, like a template that failed to execute or an invalid key pattern.
+	SyncRenderFailed SyncFailure = "RenderFailed"
+	SyncFailed       SyncFailure = "Failed"
+)
+
+// SyncError is returned by SyncOnce.
+type SyncError struct {
+	Reason SyncFailure
+	Err    error
+}
+
+func (e *SyncError) Error() string {
+	return e.Err.Error()
+}
+
+// SyncOnce waits up to timeout for every source to exist and meet its
+// requirements, projects them into their mount locations and runs the
+// reloaders if any files changed. It does not start any informer, so it is
+// meant for init containers. A zero timeout waits forever.
+func (c *Controller) SyncOnce(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	if err := c.listSelected(); err != nil {
+		if syncErr, ok := err.(*SyncError); ok {
+			return syncErr
+		}
+		return &SyncError{Reason: SyncFailed, Err: err}
+	}
+
+	keys := make([]string, 0, len(c.mounters))
+	for key := range c.mounters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		m := c.mounters[key]
+		remaining := time.Duration(0)
+		if timeout > 0 {
+			if remaining = time.Until(deadline); remaining <= 0 {
+				remaining = time.Nanosecond
+			}
+		}
+		var (
+			change   *change
+			mountErr error
+		)
+		err := wait.PollImmediate(syncPollInterval, remaining, func() (bool, error) {
+			mountErr = nil
+			obj, err := m.fetch()
+			if kerr.IsNotFound(err) {
+				log.Infof("Waiting for %s to be created\n", key)
+				return false, nil
+			} else if err != nil {
+				return false, err
+			}
+
+			change, mountErr = m.mountObject(obj)
+			if _, waiting := mountErr.(*requirementsError); waiting {
+				log.Infof("Waiting for %s: %v\n", key, mountErr)
+				return false, nil
+			}
+			return true, nil
+		})
+		switch {
+		case err == wait.ErrWaitTimeout && mountErr != nil:
+			return &SyncError{Reason: SyncRequirementsNotMet, Err: fmt.Errorf("%s still %v after %v", key, mountErr, timeout)}
+		case err == wait.ErrWaitTimeout:
+			return &SyncError{Reason: SyncNotFound, Err: fmt.Errorf("%s not found after %v", key, timeout)}
+		case kerr.IsForbidden(err):
+			return &SyncError{Reason: SyncForbidden, Err: fmt.Errorf("failed to get %s, cause %v", key, err)}
+		case err != nil:
+			return &SyncError{Reason: SyncFailed, Err: fmt.Errorf("failed to get %s, cause %v", key, err)}
+		case isValidationError(mountErr):
+			return &SyncError{Reason: SyncValidationFailed, Err: fmt.Errorf("failed to mount %s, cause %v", key, mountErr)}
+		case mountErr != nil:
+			reason := SyncFailed
+			if e, ok := mountErr.(*mountError); ok {
+				reason = e.reason
+			}
+			return &SyncError{Reason: reason, Err: fmt.Errorf("failed to mount %s, cause %v", key, mountErr)}
+		}
+		if change != nil {
+			c.pending.add(key, change)
+		}
+	}
+
+	if len(c.pending) == 0 {
+		return nil
+	}
+	if err := c.runReloaders(); err != nil {
+		return &SyncError{Reason: SyncReloadFailed, Err: err}
+	}
+	return nil
+}
+
+func isValidationError(err error) bool {
+	_, ok := err.(*validationError)
+	return ok
+}
@@ -0,0 +1,302 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+const defaultTemplateSuffix = ".tmpl"
+
+// templateData is passed to every rendered key.
+type templateData struct {
+	// Data holds every key of the source, not just the selected ones.
+	Data map[string]string
+	Pod  podInfo
+}
+
+// podInfo describes the pod kloader runs in, from the environment variables
+// POD_NAME, POD_NAMESPACE, POD_IP and NODE_NAME and the downwardAPI volume.
+type podInfo struct {
+	Name        string
+	Namespace   string
+	IP          string
+	NodeName    string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// objectGetter returns the object namespace/name of source.
+type objectGetter func(source Source, namespace, name string) (runtime.Object, error)
+
+// fetchObject gets the object from the API server.
+func fetchObject(source Source, namespace, name string) (runtime.Object, error) {
+	return source.Get(namespace, name)
+}
+
+// renderTemplates renders the selected keys that end with the template
+// suffix of spec. Unless Items map a rendered key to a path, the suffix is
+// removed from its key. data holds every key of the source, for the key
+// function and .Data. The configmap and secret functions read the data and
+// binaryData of other objects with get. Every ConfigMap and Secret they read
+// is added to refs, even if it does not exist, so that its changes can render
+// the templates again.
+func renderTemplates(client clientset.Interface, get objectGetter, namespace string, spec v1alpha1.Source, data, selected map[string][]byte, refs map[informerKey]bool) (map[string][]byte, error) {
+	if spec.Template == nil {
+		return selected, nil
+	}
+	suffix := spec.Template.Suffix
+	if suffix == "" {
+		suffix = defaultTemplateSuffix
+	}
+
+	td := templateData{Data: make(map[string]string), Pod: newPodInfo(spec.Template.DownwardAPIDir)}
+	for k, v := range data {
+		td.Data[k] = string(v)
+	}
+	funcs := templateFuncs()
+	if spec.Template.Env {
+		funcs["env"] = os.Getenv
+		funcs["expandenv"] = os.ExpandEnv
+	}
+	funcs["key"] = func(key string) (string, error) {
+		v, found := data[key]
+		if !found {
+			return "", fmt.Errorf("key %s not found", key)
+		}
+		return string(v), nil
+	}
+	namespaces := sets.NewString(spec.Template.Namespaces...)
+	namespaces.Insert(namespace)
+	reference := func(kind, name string) (string, string, error) {
+		ns, name := splitName(namespace, name)
+		if !namespaces.Has(ns) {
+			return "", "", fmt.Errorf("%s %s/%s cannot be read, namespace %s is not allowed by the template", kind, ns, name, ns)
+		}
+		refs[informerKey{kind: kind, namespace: ns, name: name}] = true
+		return ns, name, nil
+	}
+	lookup := func(source Source, name, key string) (string, error) {
+		ns, name, err := reference(source.Kind(), name)
+		if err != nil {
+			return "", err
+		}
+		obj, err := get(source, ns, name)
+		if err != nil {
+			return "", err
+		}
+		values, err := source.Data(obj)
+		if err != nil {
+			return "", err
+		}
+		v, found := values[key]
+		if !found {
+			return "", fmt.Errorf("key %s not found in %s %s/%s", key, source.GroupVersionKind().Kind, ns, name)
+		}
+		return string(v), nil
+	}
+	funcs["configmap"] = func(name, key string) (string, error) {
+		return lookup(NewConfigMapSource(client), name, key)
+	}
+	funcs["secret"] = func(name, key string) (string, error) {
+		return lookup(NewSecretSource(client), name, key)
+	}
+
+	mapped := make(map[string]bool)
+	for _, item := range spec.Items {
+		mapped[item.Key] = true
+	}
+	rendered := make(map[string][]byte)
+	for k, v := range selected {
+		if !strings.HasSuffix(k, suffix) {
+			rendered[k] = v
+			continue
+		}
+
+		t, err := template.New(k).Funcs(funcs).Option("missingkey=error").Parse(string(v))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template %s, cause %v", k, err)
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, td); err != nil {
+			return nil, fmt.Errorf("failed to render template %s, cause %v", k, err)
+		}
+		if !mapped[k] {
+			k = strings.TrimSuffix(k, suffix)
+			if _, found := selected[k]; found {
+				return nil, fmt.Errorf("key %s conflicts with the rendered template %s%s", k, k, suffix)
+			}
+		}
+		rendered[k] = buf.Bytes()
+	}
+	return rendered, nil
+}
+
+// splitName splits namespace/name, using namespace if name has none.
+func splitName(namespace, name string) (string, string) {
+	if parts := strings.SplitN(name, "/", 2); len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return namespace, name
+}
+
+func newPodInfo(downwardAPIDir string) podInfo {
+	pod := podInfo{
+		Name:      os.Getenv("POD_NAME"),
+		Namespace: os.Getenv("POD_NAMESPACE"),
+		IP:        os.Getenv("POD_IP"),
+		NodeName:  os.Getenv("NODE_NAME"),
+	}
+	if pod.Namespace == "" {
+		pod.Namespace = namespace()
+	}
+	if downwardAPIDir != "" {
+		pod.Labels = readDownwardAPIFile(filepath.Join(downwardAPIDir, "labels"))
+		pod.Annotations = readDownwardAPIFile(filepath.Join(downwardAPIDir, "annotations"))
+	}
+	return pod
+}
+
+// readDownwardAPIFile parses the key="value" lines of a downwardAPI volume
+// file. A missing file results in an empty map.
+func readDownwardAPIFile(path string) map[string]string {
+	values := make(map[string]string)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return values
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if v, err := strconv.Unquote(parts[1]); err == nil {
+			values[parts[0]] = v
+		} else {
+			values[parts[0]] = parts[1]
+		}
+	}
+	return values
+}
+
+// templateFuncs returns the helpers available in every template. They follow
+// the names and argument order of the Sprig library, so the last argument is
+// the one a pipeline passes in.
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"default": func(def, v interface{}) interface{} {
+			if empty(v) {
+				return def
+			}
+			return v
+		},
+		"empty": empty,
+		"coalesce": func(v ...interface{}) interface{} {
+			for _, x := range v {
+				if !empty(x) {
+					return x
+				}
+			}
+			return nil
+		},
+		"ternary": func(a, b interface{}, cond bool) interface{} {
+			if cond {
+				return a
+			}
+			return b
+		},
+		"required": func(msg string, v interface{}) (interface{}, error) {
+			if empty(v) {
+				return nil, errors.New(msg)
+			}
+			return v, nil
+		},
+
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"title":      strings.Title,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":       func(sep string, v []string) string { return strings.Join(v, sep) },
+		"quote":      func(s string) string { return strconv.Quote(s) },
+		"squote":     func(s string) string { return "'" + s + "'" },
+		"indent": func(n int, s string) string {
+			pad := strings.Repeat(" ", n)
+			return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+		},
+		"nindent": func(n int, s string) string {
+			pad := strings.Repeat(" ", n)
+			return "\n" + pad + strings.Replace(s, "\n", "\n"+pad, -1)
+		},
+
+		"b64enc": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"b64dec": func(s string) (string, error) {
+			data, err := base64.StdEncoding.DecodeString(s)
+			return string(data), err
+		},
+		"sha256sum": func(s string) string {
+			sum := sha256.Sum256([]byte(s))
+			return hex.EncodeToString(sum[:])
+		},
+		"toJson": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"toYaml": func(v interface{}) (string, error) {
+			data, err := yaml.Marshal(v)
+			return strings.TrimSuffix(string(data), "\n"), err
+		},
+
+		"list": func(v ...interface{}) []interface{} { return v },
+		"dict": func(v ...interface{}) (map[string]interface{}, error) {
+			if len(v)%2 != 0 {
+				return nil, fmt.Errorf("dict expects an even number of arguments")
+			}
+			d := make(map[string]interface{})
+			for i := 0; i < len(v); i += 2 {
+				d[fmt.Sprint(v[i])] = v[i+1]
+			}
+			return d, nil
+		},
+	}
+}
+
+// empty reports whether v is nil or the zero value of its type.
+func empty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	}
+	return reflect.DeepEqual(v, reflect.Zero(rv.Type()).Interface())
+}
@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestRenderTemplatesReferences(t *testing.T) {
+	configMaps := map[string]*configMap{
+		"/api/v1/namespaces/default/configmaps/app": {
+			ConfigMap: apiv1.ConfigMap{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+				Data:       map[string]string{"port": "8080"},
+			},
+			BinaryData: map[string][]byte{"banner": []byte("welcome")},
+		},
+		"/api/v1/namespaces/shared/configmaps/common": {
+			ConfigMap: apiv1.ConfigMap{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+				ObjectMeta: metav1.ObjectMeta{Namespace: "shared", Name: "common"},
+				Data:       map[string]string{"domain": "example.com"},
+			},
+		},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cm, found := configMaps[r.URL.Path]
+		if !found {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(&metav1.Status{
+				TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Status"},
+				Status:   metav1.StatusFailure,
+				Reason:   metav1.StatusReasonNotFound,
+				Message:  r.URL.Path + " not found",
+				Code:     http.StatusNotFound,
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cm)
+	}))
+	defer srv.Close()
+	client := clientset.NewForConfigOrDie(&rest.Config{Host: srv.URL})
+
+	os.Setenv("KLOADER_TEST_PORT", "9090")
+	defer os.Unsetenv("KLOADER_TEST_PORT")
+
+	cases := []struct {
+		name     string
+		template v1alpha1.Template
+		text     string
+		rendered string
+		refs     []informerKey
+		err      string
+	}{
+		{
+			name:     "same namespace",
+			text:     `{{ configmap "app" "port" }}`,
+			rendered: "8080",
+			refs:     []informerKey{{kind: kindConfigMap, namespace: "default", name: "app"}},
+		},
+		{
+			name:     "binaryData",
+			text:     `{{ configmap "app" "banner" }}`,
+			rendered: "welcome",
+			refs:     []informerKey{{kind: kindConfigMap, namespace: "default", name: "app"}},
+		},
+		{
+			name: "missing key",
+			text: `{{ configmap "app" "host" }}`,
+			err:  "key host not found in ConfigMap default/app",
+			refs: []informerKey{{kind: kindConfigMap, namespace: "default", name: "app"}},
+		},
+		{
+			name: "other namespace",
+			text: `{{ configmap "shared/common" "domain" }}`,
+			err:  "namespace shared is not allowed",
+		},
+		{
+			name:     "allowed namespace",
+			template: v1alpha1.Template{Namespaces: []string{"shared"}},
+			text:     `{{ configmap "shared/common" "domain" }}`,
+			rendered: "example.com",
+			refs:     []informerKey{{kind: kindConfigMap, namespace: "shared", name: "common"}},
+		},
+		{
+			name: "missing object is watched",
+			text: `{{ secret "tls" "tls.crt" }}`,
+			err:  "not found",
+			refs: []informerKey{{kind: kindSecret, namespace: "default", name: "tls"}},
+		},
+		{
+			name: "env is disabled",
+			text: `{{ env "KLOADER_TEST_PORT" }}`,
+			err:  `function "env" not defined`,
+		},
+		{
+			name:     "env is enabled",
+			template: v1alpha1.Template{Env: true},
+			text:     `{{ env "KLOADER_TEST_PORT" }}`,
+			rendered: "9090",
+		},
+	}
+	for _, c := range cases {
+		spec := v1alpha1.Source{Template: &c.template}
+		data := map[string][]byte{"app.conf.tmpl": []byte(c.text)}
+		refs := make(map[informerKey]bool)
+		rendered, err := renderTemplates(client, fetchObject, "default", spec, data, data, refs)
+		if c.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		} else if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s: expected error %q, found %v", c.name, c.err, err)
+		} else if c.err == "" && string(rendered["app.conf"]) != c.rendered {
+			t.Errorf("%s: expected %q, found %q", c.name, c.rendered, rendered["app.conf"])
+		}
+		expected := make(map[informerKey]bool)
+		for _, ref := range c.refs {
+			expected[ref] = true
+		}
+		if !reflect.DeepEqual(refs, expected) {
+			t.Errorf("%s: expected references %v, found %v", c.name, expected, refs)
+		}
+	}
+}
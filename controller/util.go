@@ -4,24 +4,25 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"strings"
-	"sync/atomic"
 
-	"github.com/appscode/go/log"
 	apiv1 "k8s.io/api/core/v1"
 )
 
-var updateReceived, mountPerformed uint64
-
-func incUpdateReceivedCounter() {
-	atomic.AddUint64(&updateReceived, 1)
-	log.Infoln("Update Received:", atomic.LoadUint64(&updateReceived))
-}
-
-func incMountCounter() {
-	atomic.AddUint64(&mountPerformed, 1)
-	log.Infoln("Mount Performed:", atomic.LoadUint64(&mountPerformed))
+// writePayload atomically projects payload into mountLocation.
+func writePayload(mountLocation, kind, namespace, name string, payload map[string]FileProjection) (bool, error) {
+	writer, err := NewAtomicWriter(mountLocation, kind+" "+namespace+"/"+name)
+	if err != nil {
+		return false, fmt.Errorf("failed to create atomic writer, cause %v", err)
+	}
+	changed, err := writer.Write(payload)
+	if err != nil {
+		return false, err
+	}
+	if changed {
+		incMountCounter(kind, namespace, name)
+	}
+	return changed, nil
 }
 
 func namespace() string {
@@ -35,16 +36,3 @@ func namespace() string {
 	}
 	return apiv1.NamespaceDefault
 }
-
-func runCmd(path string) error {
-	log.Infoln("calling boot file to execute")
-	output, err := exec.Command("sh", "-c", path).CombinedOutput()
-	msg := fmt.Sprintf("%v", string(output))
-	log.Infoln("Output:\n", msg)
-	if err != nil {
-		log.Errorln("failed to run cmd")
-		return fmt.Errorf("error restarting %v: %v", msg, err)
-	}
-	log.Infoln("boot file executed")
-	return nil
-}
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+	"github.com/ghodss/yaml"
+)
+
+// validationError is returned if the files projected from a source are
+// rejected by its Validation. The source is not mounted, and is not retried
+// until it changes.
+type validationError struct {
+	err error
+}
+
+func (e *validationError) Error() string {
+	return "validation failed: " + e.err.Error()
+}
+
+// Exit statuses of the shell for a command that is not executable or does
+// not exist.
+const (
+	exitNotExecutable = 126
+	exitNotFound      = 127
+)
+
+// checkPayload checks payload against the Validation of spec before it is
+// written into mountLocation. It returns a *validationError if the payload is
+// rejected, that is a file does not parse or the command exits non-zero. If
+// the command cannot be run, is not executable or not found by the shell or
+// times out, the error is returned as is, so that the source is retried.
+func checkPayload(spec v1alpha1.Source, mountLocation string, payload map[string]FileProjection) error {
+	v := spec.Validate
+	if v == nil {
+		return nil
+	}
+	if err := checkSyntax(v, payload); err != nil {
+		return &validationError{err: err}
+	}
+	if v.Command == "" {
+		return nil
+	}
+	err := runValidateCommand(v, mountLocation, payload)
+	if exitErr, exited := err.(*exitError); exited && exitErr.status != exitNotExecutable && exitErr.status != exitNotFound {
+		return &validationError{err: err}
+	}
+	return err
+}
+
+// checkSyntax parses every file of payload that matches the JSON or YAML
+// patterns of v.
+func checkSyntax(v *v1alpha1.Validation, payload map[string]FileProjection) error {
+	jsonMatchers, err := newMatchers(v.JSON)
+	if err != nil {
+		return err
+	}
+	yamlMatchers, err := newMatchers(v.YAML)
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(payload))
+	for p := range payload {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		var out interface{}
+		if matchAny(jsonMatchers, p) {
+			if err := json.Unmarshal(payload[p].Data, &out); err != nil {
+				return fmt.Errorf("%s is not valid JSON, cause %v", p, err)
+			}
+		}
+		if matchAny(yamlMatchers, p) {
+			if err := yaml.Unmarshal(payload[p].Data, &out); err != nil {
+				return fmt.Errorf("%s is not valid YAML, cause %v", p, err)
+			}
+		}
+	}
+	return nil
+}
+
+func matchAny(matchers []func(key string) bool, key string) bool {
+	for _, match := range matchers {
+		if match(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// runValidateCommand writes payload into a staging directory and runs
+// v.Command in it. The files in mountLocation are not touched.
+func runValidateCommand(v *v1alpha1.Validation, mountLocation string, payload map[string]FileProjection) error {
+	dir, err := ioutil.TempDir("", "kloader-staging-")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory, cause %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for p, file := range payload {
+		fullPath := filepath.Join(dir, p)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return fmt.Errorf("failed to stage %s, cause %v", p, err)
+		}
+		if err := ioutil.WriteFile(fullPath, file.Data, os.FileMode(file.Mode)|0400); err != nil {
+			return fmt.Errorf("failed to stage %s, cause %v", p, err)
+		}
+	}
+
+	h := &hook{command: v.Command, dir: dir}
+	if v.Timeout != nil {
+		h.timeout = v.Timeout.Duration
+	}
+	return h.run([]string{
+		"KLOADER_STAGING_DIR=" + dir,
+		"KLOADER_MOUNT_PATH=" + mountLocation,
+	})
+}
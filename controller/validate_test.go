@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestCheckPayload(t *testing.T) {
+	payload := map[string]FileProjection{
+		"app.json": {Data: []byte(`{"port": 8080}`), Mode: 0644},
+		"bad.json": {Data: []byte(`{"port": `), Mode: 0644},
+	}
+	cases := []struct {
+		name     string
+		validate v1alpha1.Validation
+		// rejected is set if a *validationError is expected
+		rejected bool
+		err      string
+	}{
+		{
+			name:     "valid JSON",
+			validate: v1alpha1.Validation{JSON: []string{"app.json"}},
+		},
+		{
+			name:     "invalid JSON",
+			validate: v1alpha1.Validation{JSON: []string{"*.json"}},
+			rejected: true,
+			err:      "bad.json is not valid JSON",
+		},
+		{
+			name:     "command accepts",
+			validate: v1alpha1.Validation{Command: `grep -q 8080 "$KLOADER_STAGING_DIR/app.json"`},
+		},
+		{
+			name:     "command exits non-zero",
+			validate: v1alpha1.Validation{Command: "echo invalid >&2; exit 1"},
+			rejected: true,
+			err:      "exited with status 1: invalid",
+		},
+		{
+			name:     "command not found",
+			validate: v1alpha1.Validation{Command: "kloader-no-such-validator"},
+			err:      "exited with status 127",
+		},
+		{
+			name:     "command not executable",
+			validate: v1alpha1.Validation{Command: `"$KLOADER_STAGING_DIR/app.json"`},
+			err:      "exited with status 126",
+		},
+		{
+			name:     "command times out",
+			validate: v1alpha1.Validation{Command: "sleep 10", Timeout: &metav1.Duration{Duration: 100 * time.Millisecond}},
+			err:      "timed out",
+		},
+	}
+	for _, c := range cases {
+		err := checkPayload(v1alpha1.Source{Validate: &c.validate}, "/etc/app", payload)
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", c.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error %q, found %v", c.name, c.err, err)
+		}
+		if rejected := isValidationError(err); rejected != c.rejected {
+			t.Errorf("%s: expected rejected %v, found %v", c.name, c.rejected, rejected)
+		}
+	}
+}
+
+func TestRejectedReference(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kloader-validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctrl := newTestController(Config{})
+	store := addTestMounter(t, ctrl, NewMounter(nil, NewSecretSource(nil), "default", "app", WithSpec(v1alpha1.Source{
+		MountPath: dir,
+		Template:  &v1alpha1.Template{Suffix: ".tmpl"},
+		Validate:  &v1alpha1.Validation{JSON: []string{"*.json"}},
+	})))
+	key := queueKey(kindSecret, "default", "app")
+	file := filepath.Join(dir, "app.json")
+
+	// the template reads a ConfigMap that is watched by an informer
+	common := func(resourceVersion, domain string) *configMap {
+		return &configMap{ConfigMap: apiv1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "common", ResourceVersion: resourceVersion},
+			Data:       map[string]string{"domain": domain},
+		}}
+	}
+	lw := &cache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			return &configMapList{ListMeta: metav1.ListMeta{ResourceVersion: "1"}, Items: []configMap{*common("1", "example.com")}}, nil
+		},
+		WatchFunc: func(metav1.ListOptions) (watch.Interface, error) {
+			return watch.NewFake(), nil
+		},
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	informer := cache.NewSharedIndexInformer(lw, NewConfigMapSource(nil).NewObject(), 0, cache.Indexers{})
+	ctrl.informers.informers[informerKey{kind: kindConfigMap, namespace: "default", name: "common"}] = informer
+	go informer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		t.Fatal("informer did not sync")
+	}
+
+	// the unquoted domain is not valid JSON
+	store.Add(&apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", ResourceVersion: "1"},
+		Data:       map[string][]byte{"app.json.tmpl": []byte(`{"domain": {{ configmap "common" "domain" }}}`)},
+	})
+	if err := ctrl.processItem(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("expected the invalid file not to be mounted, found %v", err)
+	}
+	if rejected := ctrl.rejected[key]; rejected == nil || rejected.version != "1 configmap/default/common=1" {
+		t.Errorf("expected the versions of the Secret and ConfigMap to be rejected, found %+v", rejected)
+	}
+
+	// fixing the ConfigMap mounts the Secret again, at the same resourceVersion
+	informer.GetIndexer().Update(common("2", `"example.com"`))
+	if err := ctrl.processItem(key); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(file); err != nil || string(data) != `{"domain": "example.com"}` {
+		t.Errorf("expected the fixed file to be mounted, found %q: %v", data, err)
+	}
+	if _, found := ctrl.rejected[key]; found {
+		t.Errorf("expected the rejection to be cleared")
+	}
+}
@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/appscode/go/log"
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+)
+
+const defaultWebhookTimeout = 10 * time.Second
+
+// webhook calls an HTTP endpoint that makes the application reload.
+type webhook struct {
+	spec v1alpha1.Webhook
+
+	// client and body are created on first use, so that an unreadable CA
+	// file is retried like any other failure.
+	client *http.Client
+	body   *template.Template
+}
+
+// webhookData is passed to the body template.
+type webhookData struct {
+	Sources []webhookSource
+	// Keys that were added, updated or removed in any source
+	Keys []string
+}
+
+type webhookSource struct {
+	Kind            string
+	Namespace       string
+	Name            string
+	ResourceVersion string
+	MountPath       string
+	Keys            []string
+}
+
+func (w *webhook) action() string { return "webhook" }
+
+func (w *webhook) reload(changes changeSet) error {
+	if err := w.init(); err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if w.spec.Body != "" {
+		var buf bytes.Buffer
+		if err := w.body.Execute(&buf, newWebhookData(changes)); err != nil {
+			return fmt.Errorf("failed to render webhook body, cause %v", err)
+		}
+		body = &buf
+	}
+	method := w.spec.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequest(method, w.spec.URL, body)
+	if err != nil {
+		return err
+	}
+	for k, v := range w.spec.Headers {
+		req.Header.Set(k, v)
+	}
+
+	log.Infoln("Calling webhook", method, w.spec.URL)
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook %s, cause %v", w.spec.URL, err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if !w.expected(resp.StatusCode) {
+		return fmt.Errorf("webhook %s returned status %d: %s", w.spec.URL, resp.StatusCode, bytes.TrimSpace(respBody))
+	}
+	log.Infoln("Webhook returned status", resp.StatusCode)
+	return nil
+}
+
+func (w *webhook) init() error {
+	if w.client != nil {
+		return nil
+	}
+	body, err := template.New("body").Parse(w.spec.Body)
+	if err != nil {
+		return fmt.Errorf("invalid webhook body template, cause %v", err)
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: w.spec.InsecureSkipTLSVerify}
+	if w.spec.CAFile != "" {
+		pem, err := ioutil.ReadFile(w.spec.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read webhook CA file, cause %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in webhook CA file %s", w.spec.CAFile)
+		}
+	}
+	timeout := defaultWebhookTimeout
+	if w.spec.Timeout != nil {
+		timeout = w.spec.Timeout.Duration
+	}
+
+	w.body = body
+	w.client = &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+		Timeout: timeout,
+	}
+	return nil
+}
+
+func (w *webhook) expected(code int) bool {
+	if len(w.spec.ExpectedStatusCodes) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, c := range w.spec.ExpectedStatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func newWebhookData(changes changeSet) webhookData {
+	var data webhookData
+	for _, key := range changes.sources() {
+		c := changes[key]
+		data.Sources = append(data.Sources, webhookSource{
+			Kind:            c.kind,
+			Namespace:       c.namespace,
+			Name:            c.name,
+			ResourceVersion: c.resourceVersion,
+			MountPath:       c.mountPath,
+			Keys:            c.keys,
+		})
+		data.Keys = mergeKeys(data.Keys, c.keys)
+	}
+	return data
+}
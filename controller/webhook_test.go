@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+)
+
+var testChanges = changeSet{
+	"configmap/default/nginx": {kind: "configmap", namespace: "default", name: "nginx", resourceVersion: "7", mountPath: "/etc/nginx", keys: []string{"a.conf", "b.conf"}},
+	"secret/default/tls":      {kind: "secret", namespace: "default", name: "tls", resourceVersion: "3", mountPath: "/etc/tls", keys: []string{"tls.crt"}},
+}
+
+func TestWebhookRequest(t *testing.T) {
+	var method, body string
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		method, header, body = r.Method, r.Header, string(data)
+	}))
+	defer srv.Close()
+
+	w := &webhook{spec: v1alpha1.Webhook{
+		URL:     srv.URL + "/-/reload",
+		Method:  http.MethodPut,
+		Headers: map[string]string{"Authorization": "Bearer token", "Content-Type": "application/json"},
+		Body:    `{"keys":"{{ range $i, $k := .Keys }}{{ if $i }},{{ end }}{{ $k }}{{ end }}","sources":[{{ range $i, $s := .Sources }}{{ if $i }},{{ end }}"{{ $s.Kind }}/{{ $s.Name }}@{{ $s.ResourceVersion }}"{{ end }}]}`,
+	}}
+	if err := w.reload(testChanges); err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPut {
+		t.Errorf("expected method PUT, found %s", method)
+	}
+	if header.Get("Authorization") != "Bearer token" || header.Get("Content-Type") != "application/json" {
+		t.Errorf("expected the configured headers, found %v", header)
+	}
+	if expected := `{"keys":"a.conf,b.conf,tls.crt","sources":["configmap/nginx@7","secret/tls@3"]}`; body != expected {
+		t.Errorf("expected body %s, found %s", expected, body)
+	}
+}
+
+func TestWebhookStatus(t *testing.T) {
+	cases := []struct {
+		name     string
+		status   int
+		expected []int
+		err      string
+	}{
+		{name: "any 2xx", status: http.StatusNoContent},
+		{name: "not 2xx", status: http.StatusServiceUnavailable, err: "returned status 503: reloading"},
+		{name: "expected status", status: http.StatusAccepted, expected: []int{202}},
+		{name: "unexpected 2xx", status: http.StatusOK, expected: []int{202, 204}, err: "returned status 200"},
+		{name: "expected non-2xx", status: http.StatusConflict, expected: []int{409}},
+	}
+	for _, c := range cases {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(c.status)
+			if c.status >= 300 {
+				w.Write([]byte("reloading\n"))
+			}
+		}))
+		w := &webhook{spec: v1alpha1.Webhook{URL: srv.URL, ExpectedStatusCodes: c.expected}}
+		err := w.reload(testChanges)
+		if c.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		} else if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s: expected error %q, found %v", c.name, c.err, err)
+		}
+		srv.Close()
+	}
+}
+
+// TestWebhookRetry checks that a failed call is an error the queue retries,
+// and that the next call of the same webhook can succeed.
+func TestWebhookRetry(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	w := &webhook{spec: v1alpha1.Webhook{URL: srv.URL}}
+	for i := 1; i <= 2; i++ {
+		if err := w.reload(testChanges); err == nil {
+			t.Fatalf("call %d: expected an error", i)
+		}
+	}
+	if err := w.reload(testChanges); err != nil {
+		t.Fatalf("call 3: unexpected error: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, found %d", calls)
+	}
+}
+
+func TestWebhookTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.crt")
+
+	// a missing CA file is retried like any other failure
+	w := &webhook{spec: v1alpha1.Webhook{URL: srv.URL, CAFile: caFile}}
+	if err := w.reload(testChanges); err == nil || !strings.Contains(err.Error(), "failed to read webhook CA file") {
+		t.Errorf("expected the CA file to be missing, found %v", err)
+	}
+	if err := ioutil.WriteFile(caFile, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.reload(testChanges); err == nil || !strings.Contains(err.Error(), "no certificate found") {
+		t.Errorf("expected the CA file to be invalid, found %v", err)
+	}
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.reload(testChanges); err != nil {
+		t.Errorf("expected the server to be trusted, found %v", err)
+	}
+
+	w = &webhook{spec: v1alpha1.Webhook{URL: srv.URL}}
+	if err := w.reload(testChanges); err == nil {
+		t.Errorf("expected the server to be untrusted without its CA")
+	}
+	w = &webhook{spec: v1alpha1.Webhook{URL: srv.URL, InsecureSkipTLSVerify: true}}
+	if err := w.reload(testChanges); err != nil {
+		t.Errorf("expected the server to be called without verification, found %v", err)
+	}
+}
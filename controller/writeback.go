@@ -0,0 +1,303 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appscode/go/log"
+	"github.com/fsnotify/fsnotify"
+	apiv1 "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// writeBackQueuePrefix marks a queue key whose files are written back to the source.
+	writeBackQueuePrefix = "writeback:"
+
+	defaultWriteBackDelay = time.Second
+)
+
+// watchWriteBack watches the mount location of every source with write-back
+// enabled until stopCh is closed.
+func (c *Controller) watchWriteBack(stopCh <-chan struct{}) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	for key, m := range c.mounters {
+		wb := m.spec.WriteBack
+		if wb == nil {
+			continue
+		}
+		if _, ok := m.source.(WritableSource); !ok {
+			continue
+		}
+		delay := defaultWriteBackDelay
+		if wb.Delay != nil {
+			delay = wb.Delay.Duration
+		}
+		go c.watchFiles(key, m.mountLocation, delay, stopCh)
+	}
+}
+
+// watchFiles queues the source with queue key for write-back once the files
+// in dir stopped changing for delay.
+func (c *Controller) watchFiles(key, dir string, delay time.Duration, stopCh <-chan struct{}) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Errorf("Failed to watch %s for write-back, cause %v\n", dir, err)
+		return
+	}
+	defer watcher.Close()
+	if err := watcher.Add(dir); err != nil {
+		log.Errorf("Failed to watch %s for write-back, cause %v\n", dir, err)
+		return
+	}
+	// Files edited through their symlinks change in the data dir, which is
+	// replaced on every mount, so it is watched again after every event.
+	watchDataDir := func() {
+		watcher.Add(filepath.Join(dir, dataDirName))
+	}
+	watchDataDir()
+
+	var quiet <-chan time.Time
+	for {
+		select {
+		case <-stopCh:
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			watchDataDir()
+			quiet = time.After(delay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Errorf("Error watching %s for write-back: %v\n", dir, err)
+		case <-quiet:
+			quiet = nil
+			c.queue.Add(writeBackQueuePrefix + key)
+		}
+	}
+}
+
+// writeBack updates the source with queue key from the files in its mount
+// location. The update is based on the mounted resourceVersion, so edits made
+// in the cluster since are never overwritten. Instead, the local edits are
+// discarded and the version in the cluster is mounted.
+func (c *Controller) writeBack(key string) error {
+	m, found := c.mounter(key)
+	if !found || m.spec.WriteBack == nil {
+		return nil
+	}
+	source, ok := m.source.(WritableSource)
+	if !ok || m.current.resourceVersion == "" {
+		// nothing was mounted yet, so the files have nothing to be compared with
+		return nil
+	}
+	data, removed, err := m.localChanges()
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 && len(removed) == 0 {
+		// the files were written by kloader itself
+		return nil
+	}
+	keys := localKeys(data, removed)
+
+	base := m.current.resourceVersion
+	obj, err := source.Update(m.namespace, m.name, base, data, removed)
+	if kerr.IsConflict(err) {
+		c.discardLocalChanges(key, m, keys, base)
+		c.queue.Add(key)
+		return nil
+	}
+	if err != nil {
+		incWriteBackCounter(key, writeBackFailed)
+		return fmt.Errorf("failed to write back %s, cause %v", key, err)
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	c.setEcho(key, accessor.GetResourceVersion())
+	log.Infof("Wrote back %s of %s at resourceVersion %s\n", strings.Join(keys, ", "), key, accessor.GetResourceVersion())
+	incWriteBackCounter(key, writeBackSucceeded)
+	c.recorder.eventf([]*apiv1.ObjectReference{m.reference(accessor)}, apiv1.EventTypeNormal, eventReasonWrittenBack,
+		"Wrote back %s of %s from %s at resourceVersion %s", strings.Join(keys, ", "), key, m.mountLocation, accessor.GetResourceVersion())
+
+	// The files already hold the new version. Mounting it restores their
+	// symlinks if needed, without running the reloaders for a local change.
+	if _, err := m.mountObject(obj); err != nil {
+		return err
+	}
+	setSynced(key, obj)
+	if _, found := c.pending[key]; !found {
+		m.commit()
+	}
+	return nil
+}
+
+// checkLocalChanges discards the local changes to the files of the source
+// with queue key, if any, before the version at resourceVersion received from
+// the cluster is mounted over them. Like a conflict of writeBack, the version
+// in the cluster wins.
+func (c *Controller) checkLocalChanges(key string, m *Mounter, resourceVersion string) {
+	if m.spec.WriteBack == nil || m.current.resourceVersion == "" || m.current.resourceVersion == resourceVersion {
+		return
+	}
+	if _, ok := m.source.(WritableSource); !ok {
+		return
+	}
+	data, removed, err := m.localChanges()
+	if err != nil {
+		log.Errorf("Failed to check %s for local changes, cause %v\n", key, err)
+		return
+	}
+	if len(data) == 0 && len(removed) == 0 {
+		return
+	}
+	c.discardLocalChanges(key, m, localKeys(data, removed), m.current.resourceVersion)
+}
+
+// discardLocalChanges records that the local changes to keys of the source
+// with queue key are replaced by the version in the cluster, since it was
+// changed there after resourceVersion base.
+func (c *Controller) discardLocalChanges(key string, m *Mounter, keys []string, base string) {
+	log.Errorf("Discarded local changes to %s of %s, it was changed in the cluster since resourceVersion %s\n", strings.Join(keys, ", "), key, base)
+	incWriteBackCounter(key, writeBackConflict)
+	c.recorder.eventf([]*apiv1.ObjectReference{m.reference(nil)}, apiv1.EventTypeWarning, eventReasonWriteBackConflict,
+		"Discarded local changes to %s of %s, it was changed in the cluster since resourceVersion %s", strings.Join(keys, ", "), key, base)
+}
+
+// localKeys returns the sorted keys that were changed or removed locally.
+func localKeys(data map[string][]byte, removed []string) []string {
+	keys := make([]string, 0, len(data)+len(removed))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	keys = append(keys, removed...)
+	sort.Strings(keys)
+	return keys
+}
+
+// setEcho records the resourceVersion a source was written back at.
+func (c *Controller) setEcho(key, resourceVersion string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.echoes[key] = resourceVersion
+}
+
+// isEcho reports whether obj is the version of the source with queue key
+// that kloader wrote back itself. It is mounted already, so the update is not
+// queued and cannot trigger another write-back. Updates of older versions,
+// like a resync that arrives before the echo, keep waiting for it.
+func (c *Controller) isEcho(key string, obj interface{}) bool {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	resourceVersion, found := c.echoes[key]
+	if !found {
+		return false
+	}
+	if resourceVersion == accessor.GetResourceVersion() {
+		delete(c.echoes, key)
+		return true
+	}
+	if isNewerResourceVersion(accessor.GetResourceVersion(), resourceVersion) {
+		// the echo was missed, like after the watch was restarted
+		delete(c.echoes, key)
+	}
+	return false
+}
+
+// isNewerResourceVersion reports whether resourceVersion is newer than base.
+// Resource versions are opaque, but the API server backed by etcd uses
+// increasing integers. Anything else is never newer.
+func isNewerResourceVersion(resourceVersion, base string) bool {
+	v, err := strconv.ParseUint(resourceVersion, 10, 64)
+	if err != nil {
+		return false
+	}
+	b, err := strconv.ParseUint(base, 10, 64)
+	if err != nil {
+		return false
+	}
+	return v > b
+}
+
+// localChanges compares the files in the mount location with the mounted
+// data. It returns the keys whose files changed, or were created if enabled,
+// and the keys whose files were deleted, if enabled.
+func (m *Mounter) localChanges() (map[string][]byte, []string, error) {
+	wb := m.spec.WriteBack
+	data := make(map[string][]byte)
+	var removed []string
+	for key, value := range m.current.data {
+		local, err := ioutil.ReadFile(filepath.Join(m.mountLocation, key))
+		if os.IsNotExist(err) {
+			if wb.DeleteKeys {
+				removed = append(removed, key)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if !bytes.Equal(local, value) {
+			data[key] = local
+		}
+	}
+	sort.Strings(removed)
+	if !wb.CreateKeys {
+		return data, removed, nil
+	}
+
+	entries, err := ioutil.ReadDir(m.mountLocation)
+	if err != nil {
+		return nil, nil, err
+	}
+	created := make(map[string][]byte)
+	for _, entry := range entries {
+		name := entry.Name()
+		if _, found := m.current.data[name]; found || strings.HasPrefix(name, "..") {
+			continue
+		}
+		path := filepath.Join(m.mountLocation, name)
+		if fi, err := os.Stat(path); err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		if errs := validation.IsConfigMapKey(name); len(errs) > 0 {
+			log.Infof("Not writing back %s, %s\n", path, strings.Join(errs, ", "))
+			continue
+		}
+		value, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		created[name] = value
+	}
+	created, err = selectData(m.spec, created)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range created {
+		data[k] = v
+	}
+	return data, removed, nil
+}
@@ -0,0 +1,304 @@
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/appscode/kloader/apis/kloader/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestLocalChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kloader-writeback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	mode := int32(0644)
+	cases := []struct {
+		name       string
+		createKeys bool
+		deleteKeys bool
+		data       map[string][]byte
+		removed    []string
+	}{
+		{
+			name: "changed",
+			data: map[string][]byte{"app.conf": []byte("local")},
+		},
+		{
+			name:       "created",
+			createKeys: true,
+			data:       map[string][]byte{"app.conf": []byte("local"), "new.conf": []byte("new")},
+		},
+		{
+			name:       "removed",
+			deleteKeys: true,
+			data:       map[string][]byte{"app.conf": []byte("local")},
+			removed:    []string{"gone.conf"},
+		},
+		{
+			name:       "created and removed",
+			createKeys: true,
+			deleteKeys: true,
+			data:       map[string][]byte{"app.conf": []byte("local"), "new.conf": []byte("new")},
+			removed:    []string{"gone.conf"},
+		},
+	}
+	for _, c := range cases {
+		mountPath := filepath.Join(dir, c.name)
+		if err := os.Mkdir(mountPath, 0755); err != nil {
+			t.Fatal(err)
+		}
+		m := NewMounter(nil, NewSecretSource(nil), "default", "app", WithSpec(v1alpha1.Source{
+			MountPath:   mountPath,
+			DefaultMode: &mode,
+			WriteBack:   &v1alpha1.WriteBack{CreateKeys: c.createKeys, DeleteKeys: c.deleteKeys},
+		}))
+		if _, err := m.mountObject(&apiv1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", ResourceVersion: "1"},
+			Data: map[string][]byte{
+				"app.conf":  []byte("app"),
+				"gone.conf": []byte("gone"),
+				"same.conf": []byte("same"),
+			},
+		}); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		if data, removed, err := m.localChanges(); err != nil || len(data) != 0 || len(removed) != 0 {
+			t.Errorf("%s: expected no changes to the mounted files, found %q %v: %v", c.name, data, removed, err)
+		}
+		files := map[string]string{
+			"app.conf":  "local",
+			"same.conf": "same",
+			"new.conf":  "new",
+			// neither hidden files nor invalid keys are written back
+			"..hidden":    "hidden",
+			"invalid key": "invalid",
+		}
+		for name, content := range files {
+			if err := ioutil.WriteFile(filepath.Join(mountPath, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.Remove(filepath.Join(mountPath, "gone.conf")); err != nil {
+			t.Fatal(err)
+		}
+
+		data, removed, err := m.localChanges()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(data, c.data) {
+			t.Errorf("%s: expected data %q, found %q", c.name, c.data, data)
+		}
+		if !reflect.DeepEqual(removed, c.removed) {
+			t.Errorf("%s: expected removed keys %v, found %v", c.name, c.removed, removed)
+		}
+	}
+}
+
+// newWriteBackController returns a controller that mounts the ConfigMap
+// default/app of srv into mountPath with write-back enabled.
+func newWriteBackController(t *testing.T, srv *configMapServer, mountPath string) *Controller {
+	ctrl := New(&rest.Config{Host: srv.URL}, Config{})
+	mode := int32(0644)
+	store := addTestMounter(t, ctrl, NewMounter(nil, NewConfigMapSource(ctrl.KubeClient), "default", "app", WithSpec(v1alpha1.Source{
+		MountPath:   mountPath,
+		DefaultMode: &mode,
+		WriteBack:   &v1alpha1.WriteBack{},
+	})))
+	store.Add(srv.get())
+	if err := ctrl.processItem(queueKey(kindConfigMap, "default", "app")); err != nil {
+		t.Fatal(err)
+	}
+	return ctrl
+}
+
+func testConfigMap(resourceVersion, data string) *configMap {
+	return &configMap{
+		ConfigMap: apiv1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", UID: "uid", ResourceVersion: resourceVersion},
+			Data:       map[string]string{"app.conf": data},
+		},
+	}
+}
+
+func TestWriteBackEcho(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kloader-writeback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := newConfigMapServer(testConfigMap("1", "v1"))
+	defer srv.Close()
+	ctrl := newWriteBackController(t, srv, dir)
+	key := queueKey(kindConfigMap, "default", "app")
+	informer := informerKey{kind: kindConfigMap, namespace: "default", name: "app"}
+	store := ctrl.informers.informers[informer].GetIndexer()
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "app.conf"), []byte("local"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctrl.writeBack(key); err != nil {
+		t.Fatal(err)
+	}
+	if srv.patches != 1 {
+		t.Errorf("expected 1 patch, found %d", srv.patches)
+	}
+	written := srv.get()
+	if written.Data["app.conf"] != "local" || written.ResourceVersion != "2" {
+		t.Errorf("expected app.conf to be written back at resourceVersion 2, found %q at %s", written.Data["app.conf"], written.ResourceVersion)
+	}
+
+	// the update of the ConfigMap kloader wrote back is not mounted again
+	old, _, _ := store.Get(written)
+	store.Update(written)
+	ctrl.eventHandler(informer).OnUpdate(old, written)
+	if ctrl.queue.Len() != 0 {
+		t.Errorf("expected the echo not to be queued, found %d queued keys", ctrl.queue.Len())
+	}
+	// and the files it was written back from are not written back again
+	if err := ctrl.writeBack(key); err != nil {
+		t.Fatal(err)
+	}
+	if srv.patches != 1 {
+		t.Errorf("expected no patch for the echo, found %d patches", srv.patches)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "app.conf")); err != nil || string(data) != "local" {
+		t.Errorf("expected the local edit to be kept, found %q: %v", data, err)
+	}
+}
+
+func TestWriteBackConflict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kloader-writeback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := newConfigMapServer(testConfigMap("1", "v1"))
+	defer srv.Close()
+	ctrl := newWriteBackController(t, srv, dir)
+	key := queueKey(kindConfigMap, "default", "app")
+	store := ctrl.informers.informers[informerKey{kind: kindConfigMap, namespace: "default", name: "app"}].GetIndexer()
+
+	// the ConfigMap is changed in the cluster before the local edit is written back
+	srv.set(testConfigMap("2", "cluster"))
+	if err := ioutil.WriteFile(filepath.Join(dir, "app.conf"), []byte("local"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctrl.writeBack(key); err != nil {
+		t.Fatal(err)
+	}
+	if srv.patches != 0 {
+		t.Errorf("expected no patch, found %d", srv.patches)
+	}
+	if cm := srv.get(); cm.Data["app.conf"] != "cluster" {
+		t.Errorf("expected the cluster version to be kept, found %q", cm.Data["app.conf"])
+	}
+	if ctrl.queue.Len() != 1 {
+		t.Fatalf("expected the cluster version to be queued, found %d queued keys", ctrl.queue.Len())
+	}
+
+	store.Update(srv.get())
+	ctrl.processNextItem()
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "app.conf")); err != nil || string(data) != "cluster" {
+		t.Errorf("expected the cluster version to replace the local edit, found %q: %v", data, err)
+	}
+}
+
+func TestWriteBackConflictRemoteFirst(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kloader-writeback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := newConfigMapServer(testConfigMap("1", "v1"))
+	defer srv.Close()
+	ctrl := newWriteBackController(t, srv, dir)
+	recorder := record.NewFakeRecorder(10)
+	ctrl.recorder = newEventRecorder(nil, recorder)
+	key := queueKey(kindConfigMap, "default", "app")
+	store := ctrl.informers.informers[informerKey{kind: kindConfigMap, namespace: "default", name: "app"}].GetIndexer()
+	conflicts := writeBacks.WithLabelValues(kindConfigMap, "default", "app", writeBackConflict)
+	before := counterValue(t, conflicts)
+
+	// the update from the cluster is processed before the local edit is written back
+	if err := ioutil.WriteFile(filepath.Join(dir, "app.conf"), []byte("local"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srv.set(testConfigMap("2", "cluster"))
+	store.Update(srv.get())
+	if err := ctrl.processItem(key); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "app.conf")); err != nil || string(data) != "cluster" {
+		t.Errorf("expected the cluster version to replace the local edit, found %q: %v", data, err)
+	}
+	if found := counterValue(t, conflicts) - before; found != 1 {
+		t.Errorf("expected 1 conflict to be counted, found %v", found)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, eventReasonWriteBackConflict) {
+			t.Errorf("expected a %s event, found %q", eventReasonWriteBackConflict, event)
+		}
+	default:
+		t.Errorf("expected a %s event, found none", eventReasonWriteBackConflict)
+	}
+
+	// the discarded edit is not written back afterwards
+	if err := ctrl.writeBack(key); err != nil {
+		t.Fatal(err)
+	}
+	if srv.patches != 0 {
+		t.Errorf("expected no patch, found %d", srv.patches)
+	}
+}
+
+func counterValue(t *testing.T, counter prometheus.Counter) float64 {
+	var m dto.Metric
+	if err := counter.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestIsEcho(t *testing.T) {
+	cases := []struct {
+		name    string
+		updates []string
+		echoes  []bool
+	}{
+		{name: "echo", updates: []string{"5", "5"}, echoes: []bool{true, false}},
+		{name: "resync before the echo", updates: []string{"4", "4", "5"}, echoes: []bool{false, false, true}},
+		{name: "echo missed", updates: []string{"6", "5"}, echoes: []bool{false, false}},
+	}
+	key := queueKey(kindConfigMap, "default", "app")
+	for _, c := range cases {
+		ctrl := &Controller{echoes: make(map[string]string)}
+		ctrl.setEcho(key, "5")
+		for i, rv := range c.updates {
+			cm := testConfigMap(rv, "v")
+			if echo := ctrl.isEcho(key, &cm.ConfigMap); echo != c.echoes[i] {
+				t.Errorf("%s: expected update %d at resourceVersion %s to be an echo %v, found %v", c.name, i, rv, c.echoes[i], echo)
+			}
+		}
+	}
+}